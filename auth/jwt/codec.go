@@ -0,0 +1,62 @@
+package jwt
+
+import (
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// TokenCodec converts claims to a token string and back.
+// Decode must verify the integrity of the token, while the time based checks
+// (exp, nbf) are left to the Middleware so that every codec behaves the same.
+type TokenCodec interface {
+	Encode(claims *CustomClaims) (string, error)
+	Decode(token string, claims *CustomClaims) error
+}
+
+// jwtCodec is the default codec which signs the claims as a JSON Web Token
+// with the key settings of the middleware
+type jwtCodec struct {
+	middleware *Middleware
+}
+
+// jwtClaims adapts CustomClaims to the claims interface of the jwt library,
+// the validation is done by the Middleware instead
+type jwtClaims struct {
+	*CustomClaims
+}
+
+func (jwtClaims) Valid() error {
+	return nil
+}
+
+func (codec jwtCodec) Encode(claims *CustomClaims) (string, error) {
+	method := jwt.GetSigningMethod(codec.middleware.SigningAlgorithm)
+	if method == nil {
+		return "", ErrInvalidSigningAlgorithm
+	}
+
+	var key interface{} = codec.middleware.SigningKey
+	if codec.middleware.usingPublicKeyAlgorithm() {
+		key = codec.middleware.privKey
+	}
+	return jwt.NewWithClaims(method, jwtClaims{claims}).SignedString(key)
+}
+
+func (codec jwtCodec) Decode(token string, claims *CustomClaims) error {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{codec.middleware.SigningAlgorithm}),
+		jwt.WithoutClaimsValidation(),
+	)
+	_, err := parser.ParseWithClaims(token, &jwtClaims{claims}, codec.keyFunc)
+	return err
+}
+
+func (codec jwtCodec) keyFunc(t *jwt.Token) (interface{}, error) {
+	if jwt.GetSigningMethod(codec.middleware.SigningAlgorithm) != t.Method {
+		return nil, ErrInvalidSigningAlgorithm
+	}
+	if codec.middleware.usingPublicKeyAlgorithm() {
+		return codec.middleware.pubKey, nil
+	}
+
+	return codec.middleware.SigningKey, nil
+}
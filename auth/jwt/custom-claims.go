@@ -1,13 +1,30 @@
 package jwt
 
 import (
-	"github.com/dgrijalva/jwt-go"
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
+// TimeFunc provides the current time when checking the expiry of tokens.
+// Override it to use another time value, e.g. in tests
+var TimeFunc = time.Now
+
+// StandardClaims are the registered claims of RFC 7519,
+// every TokenCodec keeps them with the same json name
+type StandardClaims struct {
+	Audience  string `json:"aud,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	Id        string `json:"jti,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+}
+
 // CustomClaims records authorization information
 type CustomClaims struct {
-	jwt.StandardClaims
+	StandardClaims
 	IsRefreshToken bool
 	RefreshTarget *CustomClaims
 	CustomField interface{}
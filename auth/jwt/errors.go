@@ -59,4 +59,47 @@ var (
 
 	// ErrInvalidPubKey indicates the the given public key is invalid
 	ErrInvalidPubKey = errors.New("public key invalid")
+
+	// ErrInvalidPasetoKey indicates the symmetric key of v4.local is not 32 bytes long
+	ErrInvalidPasetoKey = errors.New("paseto key must be 32 bytes")
+
+	// ErrMalformedToken indicates the token could not be decoded by the codec
+	ErrMalformedToken = errors.New("token is malformed")
+
+	// ErrTokenVerificationFailed indicates the signature or the authentication tag of token mismatched
+	ErrTokenVerificationFailed = errors.New("token verification failed")
+
+	// ErrTokenNotValidYet indicates the nbf field of token is in the future
+	ErrTokenNotValidYet = errors.New("token is not valid yet")
+
+	// ErrMissingTenantLookup indicates TenantLookup is required to resolve tenants
+	ErrMissingTenantLookup = errors.New("tenant lookup is undefined")
+
+	// ErrUnknownTenant indicates the tenant of request is not registered
+	ErrUnknownTenant = errors.New("unknown tenant")
+
+	// ErrMissingTenantIssuer indicates the tenant has no Issuer, its tokens would carry
+	// the signing key in the iss claim otherwise
+	ErrMissingTenantIssuer = errors.New("tenant issuer is undefined")
+
+	// ErrTenantMismatch indicates the token was issued by another tenant
+	ErrTenantMismatch = errors.New("token is issued by another tenant")
+
+	// ErrTokenNotFound indicates the opaque token is unknown, expired or revoked
+	ErrTokenNotFound = errors.New("token not found")
+
+	// ErrMissingSessionStore indicates Sessions is required to manage sessions
+	ErrMissingSessionStore = errors.New("session store is undefined")
+
+	// ErrMissingSubjectFunc indicates SubjectFunc is required to track the sessions per subject
+	ErrMissingSubjectFunc = errors.New("subject func is undefined")
+
+	// ErrTooManySessions indicates the subject reached MaxSessions under RejectNewSession
+	ErrTooManySessions = errors.New("too many active sessions")
+
+	// ErrSessionNotFound indicates the session to remove does not exist
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrSessionRevoked indicates the session of refresh token has been revoked or evicted
+	ErrSessionRevoked = errors.New("session is revoked")
 )
@@ -6,7 +6,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
@@ -31,6 +30,28 @@ type Middleware struct {
 	RefreshSecond  int64
 	ExpireSecond int64
 
+	// Issuer of the generated tokens, SigningKeyString is used if it is empty
+	Issuer string
+
+	// Codec encodes the claims into tokens, a JSON Web Token signed by
+	// the settings above is used if it is nil
+	Codec TokenCodec
+
+	// TenantResolver and TenantLookup switch the key settings per request,
+	// see ForTenant
+	TenantResolver TenantResolver
+	TenantLookup   TenantLookup
+
+	// SubjectFunc extracts the sub claim of generated tokens from the custom field
+	SubjectFunc func(field interface{}) string
+
+	// Sessions tracks the refresh token families per subject given by SubjectFunc,
+	// at most MaxSessions families are active if it is positive, see SessionLimitPolicy.
+	// Build looks up the session of every request carrying a family id
+	Sessions           SessionStore
+	MaxSessions        int
+	SessionLimitPolicy SessionLimitPolicy
+
 	customClaimsFactory CustomClaimsFactory
 	validFunction       CustomClaimsValidateFunction
 }
@@ -53,6 +74,9 @@ func NewMiddleWare(
 	}
 }
 
+// ClaimsKey is the key of the *CustomClaims in gin context set by Build
+const ClaimsKey = "claims"
+
 // UnauthorizedMessage just return code with reason
 type UnauthorizedMessage struct {
 	Code int64  `json:"code"`
@@ -64,6 +88,10 @@ func (middleware *Middleware) Build() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		claims, err := middleware.CheckIfTokenExpire(c)
+		if err == nil {
+			// the access tokens of a revoked or evicted session are rejected at once
+			err = middleware.checkSession(claims)
+		}
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, UnauthorizedMessage{
 				Code: -1,
@@ -83,7 +111,7 @@ func (middleware *Middleware) Build() gin.HandlerFunc {
 		}
 
 		// store the context for stateful session
-		c.Set("claims", claims)
+		c.Set(ClaimsKey, claims)
 	}
 }
 
@@ -91,48 +119,61 @@ func (middleware *Middleware) Build() gin.HandlerFunc {
 func (middleware *Middleware) GenerateToken(field interface{}) (string, error) {
 	return middleware.CreateToken(CustomClaims{
 		CustomField: field,
-		StandardClaims: jwt.StandardClaims{
+		StandardClaims: StandardClaims{
 			NotBefore: time.Now().Unix() - 10,
 			ExpiresAt: time.Now().Unix() + middleware.ExpireSecond,
-			Issuer:    middleware.SigningKeyString,
+			Issuer:    middleware.issuer(),
+			Subject:   middleware.subject(field),
 		},
 	})
 }
 
-// GenerateToken with expired time
+// GenerateToken with expired time, the refresh token opens a session of
+// the subject if the Sessions store is set
 func (middleware *Middleware) GenerateTokenWithRefreshToken(field interface{}) (string, string, error) {
+	sub := middleware.subject(field)
+	familyID, err := middleware.openSession(sub)
+	if err != nil {
+		return "", "", err
+	}
+
 	c := CustomClaims{
 		CustomField: field,
-		StandardClaims: jwt.StandardClaims{
+		StandardClaims: StandardClaims{
 			NotBefore: time.Now().Unix() - 10,
 			ExpiresAt: time.Now().Unix() + middleware.ExpireSecond,
-			Issuer:    middleware.SigningKeyString,
+			Issuer:    middleware.issuer(),
+			Subject:   sub,
+			Id:        familyID,
 		},
 	}
 	cs, err := middleware.CreateToken(c)
 	if err != nil {
-		return "", "", nil
+		middleware.closeSession(sub, familyID)
+		return "", "", err
 	}
 	rs, err := middleware.CreateToken(CustomClaims{
 		CustomField: field,
-		StandardClaims: jwt.StandardClaims{
+		StandardClaims: StandardClaims{
 			NotBefore: time.Now().Unix() - 10,
 			ExpiresAt: time.Now().Unix() + middleware.RefreshSecond,
-			Issuer:    middleware.SigningKeyString,
+			Issuer:    middleware.issuer(),
+			Subject:   sub,
+			Id:        familyID,
 		},
 		IsRefreshToken: true,
 		RefreshTarget:  &c,
 	})
 	if err != nil {
-		return "", "", nil
+		middleware.closeSession(sub, familyID)
+		return "", "", err
 	}
 	return cs, rs, nil
 }
 
 // CreateToken generate a token
 func (middleware *Middleware) CreateToken(claims CustomClaims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(middleware.SigningKey)
+	return middleware.codec().Encode(&claims)
 }
 
 // RefreshToken if ok
@@ -141,9 +182,16 @@ func (middleware *Middleware) RefreshToken(c *gin.Context) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	tenant, err := middleware.resolveTenant(c)
+	if err != nil {
+		return "", err
+	}
+	if err = middleware.checkSession(claims); err != nil {
+		return "", err
+	}
 	if claims.IsRefreshToken {
-		claims.RefreshTarget.ExpiresAt = jwt.TimeFunc().Unix() + middleware.ExpireSecond
-		return middleware.CreateToken(*claims.RefreshTarget)
+		claims.RefreshTarget.ExpiresAt = TimeFunc().Unix() + middleware.ExpireSecond
+		return tenant.CreateToken(*claims.RefreshTarget)
 	} else {
 		return "", ErrInvalidAuthHeader
 	}
@@ -156,13 +204,20 @@ func (middleware *Middleware) RefreshTokenFunc(c *gin.Context, operate func(*Cus
 		if err != nil {
 			return "", err
 		}
+		tenant, err := middleware.resolveTenant(c)
+		if err != nil {
+			return "", err
+		}
+		if err = middleware.checkSession(claims); err != nil {
+			return "", err
+		}
 		if claims.IsRefreshToken {
-			claims.RefreshTarget.ExpiresAt = jwt.TimeFunc().Unix() + middleware.RefreshSecond
+			claims.RefreshTarget.ExpiresAt = TimeFunc().Unix() + middleware.RefreshSecond
 			err = operate(claims)
 			if err != nil {
 				return "", err
 			}
-			return middleware.CreateToken(*claims.RefreshTarget)
+			return tenant.CreateToken(*claims.RefreshTarget)
 		} else {
 			return "", ErrInvalidAuthHeader
 		}
@@ -171,53 +226,66 @@ func (middleware *Middleware) RefreshTokenFunc(c *gin.Context, operate func(*Cus
 
 // CheckIfTokenExpire check if token expire
 func (middleware *Middleware) CheckIfTokenExpire(c *gin.Context) (*CustomClaims, error) {
-	token, err := middleware.ParseToken(c)
+	claims, err := middleware.ParseToken(c)
 	if err != nil {
-		validationErr, ok := err.(*jwt.ValidationError)
-		if !ok || validationErr.Errors != jwt.ValidationErrorExpired {
-			return nil, err
-		}
-	}
-
-	if token == nil {
-		return nil, ErrEmptyAuthHeader
+		return nil, err
 	}
 
-	claims := token.Claims.(*CustomClaims)
-
-	if claims.ExpiresAt < jwt.TimeFunc().Unix() {
+	now := TimeFunc().Unix()
+	if claims.ExpiresAt < now {
 		return nil, ErrExpiredToken
 	}
+	if claims.NotBefore > now {
+		return nil, ErrTokenNotValidYet
+	}
 
 	return claims, nil
 }
 
-func (middleware *Middleware) ParseWithClaims(token string) (*jwt.Token, error) {
-	return jwt.ParseWithClaims(token, middleware.customClaimsFactory(), middleware.KeyFunc)
+func (middleware *Middleware) codec() TokenCodec {
+	if middleware.Codec != nil {
+		return middleware.Codec
+	}
+	return jwtCodec{middleware: middleware}
+}
+
+// ParseWithClaims decodes the token by the Codec without checking if it expires
+func (middleware *Middleware) ParseWithClaims(token string) (*CustomClaims, error) {
+	claims := middleware.customClaimsFactory()
+	if err := middleware.codec().Decode(token, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
 }
 
 // ParseToken check and return if token in the context
-func (middleware *Middleware) ParseToken(c *gin.Context) (*jwt.Token, error) {
+func (middleware *Middleware) ParseToken(c *gin.Context) (*CustomClaims, error) {
 	token, err := middleware.jwtFromHeader(c)
 	if err != nil {
 		return nil, err
 	}
 
-	return middleware.ParseWithClaims(token)
-}
-
-func (middleware *Middleware) KeyFunc(t *jwt.Token) (interface{}, error) {
-	if jwt.GetSigningMethod(middleware.SigningAlgorithm) != t.Method {
-		return nil, ErrInvalidSigningAlgorithm
+	tenant, err := middleware.resolveTenant(c)
+	if err != nil {
+		return nil, err
 	}
-	if middleware.usingPublicKeyAlgorithm() {
-		return middleware.pubKey, nil
+	claims, err := tenant.ParseWithClaims(token)
+	if err != nil {
+		return nil, err
 	}
 
-	// save token string if valid
-	//c.Set("JWT_TOKEN", token)
+	// reject the token issued to another tenant
+	if tenant != middleware && claims.Issuer != tenant.issuer() {
+		return nil, ErrTenantMismatch
+	}
+	return claims, nil
+}
 
-	return middleware.SigningKey, nil
+func (middleware *Middleware) issuer() string {
+	if len(middleware.Issuer) != 0 {
+		return middleware.Issuer
+	}
+	return middleware.SigningKeyString
 }
 
 func (middleware *Middleware) jwtFromHeader(c *gin.Context) (string, error) {
@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -184,10 +185,26 @@ func TestMiddleware_GenerateToken(t *testing.T) {
 	fmt.Println("result", result)
 }
 
+func TestMiddleware_ParseWithClaims(t *testing.T) {
+	token, err := jwtMW.CreateToken(CustomClaims{
+		StandardClaims: StandardClaims{Subject: "42"},
+		CustomField:    "field",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
+	claims, err := jwtMW.ParseWithClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "42" || claims.CustomField != "field" {
+		t.Error("bad claims", claims)
+	}
 
-
-
-
-
-
+	// alg: none
+	parts := strings.Split(token, ".")
+	if _, err = jwtMW.ParseWithClaims("eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + parts[1] + "."); err == nil {
+		t.Error("unsigned token accepted")
+	}
+}
@@ -0,0 +1,129 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// TokenStore keeps the claims of opaque tokens on the server side
+type TokenStore interface {
+	// Put stores the value until expireAt
+	Put(key string, value []byte, expireAt time.Time) error
+	// Get return ErrTokenNotFound if the key is missing or expired
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// OpaqueCodec issues short random tokens as references to the claims
+// which live in the TokenStore, so that a token can be revoked instantly
+type OpaqueCodec struct {
+	store TokenStore
+}
+
+// NewOpaqueCodec return an opaque token codec backed by the store
+func NewOpaqueCodec(store TokenStore) *OpaqueCodec {
+	return &OpaqueCodec{store: store}
+}
+
+func (codec *OpaqueCodec) Encode(claims *CustomClaims) (string, error) {
+	value, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	if err = codec.store.Put(opaqueKey(token), value, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (codec *OpaqueCodec) Decode(token string, claims *CustomClaims) error {
+	value, err := codec.store.Get(opaqueKey(token))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(value, claims)
+}
+
+// Revoke removes the claims of the token from the store
+func (codec *OpaqueCodec) Revoke(token string) error {
+	return codec.store.Delete(opaqueKey(token))
+}
+
+// opaqueKey hashes the token so that the store never holds a usable token
+func opaqueKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// memoryTokenSweep is the number of puts between two sweeps of expired entries
+const memoryTokenSweep = 1024
+
+type memoryTokenEntry struct {
+	value    []byte
+	expireAt time.Time
+}
+
+// MemoryTokenStore is a TokenStore and SessionStore in the memory of a single instance
+type MemoryTokenStore struct {
+	mutex    sync.RWMutex
+	entries  map[string]memoryTokenEntry
+	puts     int
+	sessions map[string]map[string]*Session
+}
+
+// NewMemoryTokenStore return an empty MemoryTokenStore
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		entries:  make(map[string]memoryTokenEntry),
+		sessions: make(map[string]map[string]*Session),
+	}
+}
+
+func (store *MemoryTokenStore) Put(key string, value []byte, expireAt time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.entries[key] = memoryTokenEntry{value: value, expireAt: expireAt}
+
+	if store.puts++; store.puts%memoryTokenSweep == 0 {
+		now := TimeFunc()
+		for k, entry := range store.entries {
+			if entry.expireAt.Before(now) {
+				delete(store.entries, k)
+			}
+		}
+	}
+	return nil
+}
+
+func (store *MemoryTokenStore) Get(key string) ([]byte, error) {
+	store.mutex.RLock()
+	entry, ok := store.entries[key]
+	store.mutex.RUnlock()
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	if entry.expireAt.Before(TimeFunc()) {
+		_ = store.Delete(key)
+		return nil, ErrTokenNotFound
+	}
+	return entry.value, nil
+}
+
+func (store *MemoryTokenStore) Delete(key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.entries, key)
+	return nil
+}
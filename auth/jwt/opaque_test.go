@@ -0,0 +1,47 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpaqueCodec(t *testing.T) {
+	codec := NewOpaqueCodec(NewMemoryTokenStore())
+	mw := newCodecMiddleware(codec)
+
+	token, err := mw.GenerateToken(&codecField{UID: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(mw.Build())
+	r.GET("/ping", func(c *gin.Context) {
+		claims := c.MustGet("claims").(*CustomClaims)
+		if claims.CustomField.(*codecField).UID != 7 {
+			t.Error("bad custom field", claims.CustomField)
+		}
+		c.JSON(http.StatusOK, gin.H{"pong": ""})
+	})
+
+	ping := func() int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := ping(); code != http.StatusOK {
+		t.Error("bad code", code)
+	}
+	if err = codec.Revoke(token); err != nil {
+		t.Fatal(err)
+	}
+	if code := ping(); code != http.StatusUnauthorized {
+		t.Error("revoked token accepted", code)
+	}
+}
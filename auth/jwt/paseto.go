@@ -0,0 +1,297 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	pasetoV4LocalHeader  = "v4.local."
+	pasetoV4PublicHeader = "v4.public."
+)
+
+// registered claims which PASETO encodes as ISO 8601 strings instead of unix time
+var pasetoTimeClaims = []string{"exp", "nbf", "iat"}
+
+// pasetoNonce fills the nonce of v4.local tokens, the tests fix it to check the known-answer vectors
+var pasetoNonce = func(n []byte) error {
+	_, err := rand.Read(n)
+	return err
+}
+
+// PasetoV4Local encrypts the claims into v4.local PASETO tokens with a shared 32-byte key
+type PasetoV4Local struct {
+	key []byte
+
+	// Footer is appended to every token in plaintext and must match on decoding
+	Footer []byte
+	// Implicit assertion is authenticated but not stored in the token
+	Implicit []byte
+}
+
+// NewPasetoV4Local return a v4.local codec with the symmetric key
+func NewPasetoV4Local(key []byte) (*PasetoV4Local, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidPasetoKey
+	}
+	return &PasetoV4Local{key: key}, nil
+}
+
+func (codec *PasetoV4Local) Encode(claims *CustomClaims) (string, error) {
+	m, err := marshalPasetoClaims(claims)
+	if err != nil {
+		return "", err
+	}
+
+	n := make([]byte, 32)
+	if err = pasetoNonce(n); err != nil {
+		return "", err
+	}
+	return codec.seal(m, n)
+}
+
+func (codec *PasetoV4Local) Decode(token string, claims *CustomClaims) error {
+	m, err := codec.open(token)
+	if err != nil {
+		return err
+	}
+	return unmarshalPasetoClaims(m, claims)
+}
+
+// seal encrypts the payload with the nonce
+func (codec *PasetoV4Local) seal(m, n []byte) (string, error) {
+	ek, n2, ak := codec.splitKey(n)
+	stream, err := chacha20.NewUnauthenticatedCipher(ek, n2)
+	if err != nil {
+		return "", err
+	}
+	c := make([]byte, len(m))
+	stream.XORKeyStream(c, m)
+
+	t := codec.tag(ak, n, c)
+	body := make([]byte, 0, len(n)+len(c)+len(t))
+	body = append(append(append(body, n...), c...), t...)
+	return pasetoJoin(pasetoV4LocalHeader, body, codec.Footer), nil
+}
+
+// open authenticates the token and return the decrypted payload
+func (codec *PasetoV4Local) open(token string) ([]byte, error) {
+	body, err := pasetoSplit(pasetoV4LocalHeader, token, codec.Footer)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < 64 {
+		return nil, ErrMalformedToken
+	}
+
+	n, c, t := body[:32], body[32:len(body)-32], body[len(body)-32:]
+	ek, n2, ak := codec.splitKey(n)
+	if subtle.ConstantTimeCompare(t, codec.tag(ak, n, c)) != 1 {
+		return nil, ErrTokenVerificationFailed
+	}
+
+	stream, err := chacha20.NewUnauthenticatedCipher(ek, n2)
+	if err != nil {
+		return nil, err
+	}
+	m := make([]byte, len(c))
+	stream.XORKeyStream(m, c)
+	return m, nil
+}
+
+// splitKey derives the encryption key, the XChaCha20 nonce and the authentication key
+func (codec *PasetoV4Local) splitKey(n []byte) (ek, n2, ak []byte) {
+	tmp := pasetoHash(codec.key, 56, []byte("paseto-encryption-key"), n)
+	return tmp[:32], tmp[32:], pasetoHash(codec.key, 32, []byte("paseto-auth-key-for-aead"), n)
+}
+
+func (codec *PasetoV4Local) tag(ak, n, c []byte) []byte {
+	return pasetoHash(ak, 32, pae([]byte(pasetoV4LocalHeader), n, c, codec.Footer, codec.Implicit))
+}
+
+// PasetoV4Public signs the claims into v4.public PASETO tokens with an Ed25519 key pair
+type PasetoV4Public struct {
+	privKey ed25519.PrivateKey
+	pubKey  ed25519.PublicKey
+
+	// Footer is appended to every token in plaintext and must match on decoding
+	Footer []byte
+	// Implicit assertion is authenticated but not stored in the token
+	Implicit []byte
+}
+
+// NewPasetoV4Public return a v4.public codec, the private key can be nil if the
+// codec is used to verify tokens only
+func NewPasetoV4Public(privKey ed25519.PrivateKey, pubKey ed25519.PublicKey) (*PasetoV4Public, error) {
+	if privKey != nil {
+		if len(privKey) != ed25519.PrivateKeySize {
+			return nil, ErrInvalidPrivKey
+		}
+		if pubKey == nil {
+			pubKey = privKey.Public().(ed25519.PublicKey)
+		}
+	}
+	if len(pubKey) != ed25519.PublicKeySize {
+		return nil, ErrInvalidPubKey
+	}
+	return &PasetoV4Public{privKey: privKey, pubKey: pubKey}, nil
+}
+
+func (codec *PasetoV4Public) Encode(claims *CustomClaims) (string, error) {
+	if codec.privKey == nil {
+		return "", ErrInvalidPrivKey
+	}
+	m, err := marshalPasetoClaims(claims)
+	if err != nil {
+		return "", err
+	}
+	return codec.sign(m), nil
+}
+
+func (codec *PasetoV4Public) Decode(token string, claims *CustomClaims) error {
+	m, err := codec.verify(token)
+	if err != nil {
+		return err
+	}
+	return unmarshalPasetoClaims(m, claims)
+}
+
+// sign return the token of the payload, the private key must be set
+func (codec *PasetoV4Public) sign(m []byte) string {
+	sig := ed25519.Sign(codec.privKey, pae([]byte(pasetoV4PublicHeader), m, codec.Footer, codec.Implicit))
+	return pasetoJoin(pasetoV4PublicHeader, append(m[:len(m):len(m)], sig...), codec.Footer)
+}
+
+// verify checks the signature of the token and return the payload
+func (codec *PasetoV4Public) verify(token string) ([]byte, error) {
+	body, err := pasetoSplit(pasetoV4PublicHeader, token, codec.Footer)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < ed25519.SignatureSize {
+		return nil, ErrMalformedToken
+	}
+
+	m, sig := body[:len(body)-ed25519.SignatureSize], body[len(body)-ed25519.SignatureSize:]
+	if !ed25519.Verify(codec.pubKey, pae([]byte(pasetoV4PublicHeader), m, codec.Footer, codec.Implicit), sig) {
+		return nil, ErrTokenVerificationFailed
+	}
+	return m, nil
+}
+
+// pae is the Pre-Authentication Encoding of PASETO
+func pae(pieces ...[]byte) []byte {
+	var le64 [8]byte
+	binary.LittleEndian.PutUint64(le64[:], uint64(len(pieces)))
+	out := append([]byte{}, le64[:]...)
+	for _, piece := range pieces {
+		binary.LittleEndian.PutUint64(le64[:], uint64(len(piece)))
+		out = append(append(out, le64[:]...), piece...)
+	}
+	return out
+}
+
+func pasetoHash(key []byte, size int, msg ...[]byte) []byte {
+	h, err := blake2b.New(size, key)
+	if err != nil {
+		// size and key length are fixed by the callers
+		panic(err)
+	}
+	for _, m := range msg {
+		h.Write(m)
+	}
+	return h.Sum(nil)
+}
+
+func pasetoJoin(header string, body, footer []byte) string {
+	token := header + base64.RawURLEncoding.EncodeToString(body)
+	if len(footer) != 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(footer)
+	}
+	return token
+}
+
+func pasetoSplit(header, token string, footer []byte) ([]byte, error) {
+	if !strings.HasPrefix(token, header) {
+		return nil, ErrMalformedToken
+	}
+	parts := strings.Split(token[len(header):], ".")
+	if len(parts) > 2 {
+		return nil, ErrMalformedToken
+	}
+
+	var tokenFooter []byte
+	if len(parts) == 2 {
+		var err error
+		if tokenFooter, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+			return nil, ErrMalformedToken
+		}
+	}
+	if subtle.ConstantTimeCompare(tokenFooter, footer) != 1 {
+		return nil, ErrTokenVerificationFailed
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	return body, nil
+}
+
+func marshalPasetoClaims(claims *CustomClaims) ([]byte, error) {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	var payload map[string]json.RawMessage
+	if err = json.Unmarshal(b, &payload); err != nil {
+		return nil, err
+	}
+
+	for _, key := range pasetoTimeClaims {
+		if raw, ok := payload[key]; ok {
+			var unix int64
+			if err = json.Unmarshal(raw, &unix); err != nil {
+				return nil, err
+			}
+			payload[key], _ = json.Marshal(time.Unix(unix, 0).UTC().Format(time.RFC3339))
+		}
+	}
+	return json.Marshal(payload)
+}
+
+func unmarshalPasetoClaims(b []byte, claims *CustomClaims) error {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(b, &payload); err != nil {
+		return ErrMalformedToken
+	}
+
+	for _, key := range pasetoTimeClaims {
+		if raw, ok := payload[key]; ok {
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return ErrMalformedToken
+			}
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return ErrMalformedToken
+			}
+			payload[key], _ = json.Marshal(t.Unix())
+		}
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, claims)
+}
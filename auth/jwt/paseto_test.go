@@ -0,0 +1,240 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ed25519"
+)
+
+type codecField struct {
+	UID int
+}
+
+func newCodecMiddleware(codec TokenCodec) *Middleware {
+	mw := NewMiddleWare(func() *CustomClaims {
+		var cc = new(CustomClaims)
+		cc.CustomField = &codecField{}
+		return cc
+	}, func(c *gin.Context, cc *CustomClaims) error {
+		return nil
+	})
+	mw.ExpireSecond = 60
+	mw.Codec = codec
+	return mw
+}
+
+func testPasetoCodec(t *testing.T, codec TokenCodec, header string) {
+	mw := newCodecMiddleware(codec)
+
+	token, err := mw.GenerateToken(&codecField{UID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, header) {
+		t.Fatal("bad header", token)
+	}
+
+	r := gin.New()
+	r.Use(mw.Build())
+	r.GET("/ping", func(c *gin.Context) {
+		claims := c.MustGet("claims").(*CustomClaims)
+		if claims.CustomField.(*codecField).UID != 42 {
+			t.Error("bad custom field", claims.CustomField)
+		}
+		c.JSON(http.StatusOK, gin.H{"pong": ""})
+	})
+
+	for _, tc := range []struct {
+		token string
+		code  int
+	}{
+		{token, http.StatusOK},
+		{token[:len(token)-2] + "AA", http.StatusUnauthorized},
+		{strings.Replace(token, header, "v3.local.", 1), http.StatusUnauthorized},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		r.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Error("bad code", w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestPasetoV4Local(t *testing.T) {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	codec, err := NewPasetoV4Local(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPasetoCodec(t, codec, pasetoV4LocalHeader)
+
+	if _, err = NewPasetoV4Local(key[:16]); err != ErrInvalidPasetoKey {
+		t.Error("short key accepted")
+	}
+}
+
+func TestPasetoV4Public(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec, err := NewPasetoV4Public(priv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec.Footer = []byte(`{"kid":"test"}`)
+	testPasetoCodec(t, codec, pasetoV4PublicHeader)
+
+	token, err := codec.Encode(&CustomClaims{CustomField: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewPasetoV4Public(nil, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = verifier.Decode(token, new(CustomClaims)); err != ErrTokenVerificationFailed {
+		t.Error("footer mismatch accepted", err)
+	}
+	verifier.Footer = codec.Footer
+	if err = verifier.Decode(token, new(CustomClaims)); err != nil {
+		t.Error(err)
+	}
+	if _, err = verifier.Encode(&CustomClaims{}); err != ErrInvalidPrivKey {
+		t.Error("verify-only codec signed a token")
+	}
+}
+
+func TestPAE(t *testing.T) {
+	for _, tc := range []struct {
+		pieces [][]byte
+		want   string
+	}{
+		{nil, "0000000000000000"},
+		{[][]byte{{}}, "01000000000000000000000000000000"},
+		{[][]byte{{}, {}}, "020000000000000000000000000000000000000000000000"},
+		{[][]byte{[]byte("Paragon")}, "0100000000000000070000000000000050617261676f6e"},
+	} {
+		if got := hex.EncodeToString(pae(tc.pieces...)); got != tc.want {
+			t.Error("bad pae", tc.pieces, got)
+		}
+	}
+}
+
+// the known-answer vectors of the PASETO specification
+var pasetoV4LocalVectors = []struct {
+	name, nonce, token, payload string
+}{
+	{
+		"4-E-1",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQg",
+		`{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`,
+	},
+	{
+		"4-E-2",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvS2csCgglvpk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XIemu9chy3WVKvRBfg6t8wwYHK0ArLxxfZP73W_vfwt5A",
+		`{"data":"this is a hidden message","exp":"2022-01-01T00:00:00+00:00"}`,
+	},
+}
+
+var pasetoV4PublicVectors = []struct {
+	name, secretKey, publicKey, token, payload string
+}{
+	{
+		"4-S-1",
+		"b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a37741eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2",
+		"1eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2",
+		"v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA",
+		`{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`,
+	},
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPasetoV4LocalVectors(t *testing.T) {
+	key := mustHex(t, "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f")
+	for _, v := range pasetoV4LocalVectors {
+		codec, err := NewPasetoV4Local(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := codec.seal([]byte(v.payload), mustHex(t, v.nonce))
+		if err != nil || token != v.token {
+			t.Error("bad token", v.name, token, err)
+		}
+		if m, err := codec.open(v.token); err != nil || string(m) != v.payload {
+			t.Error("bad payload", v.name, string(m), err)
+		}
+
+		var claims CustomClaims
+		if err = codec.Decode(v.token, &claims); err != nil || claims.ExpiresAt != 1640995200 {
+			t.Error("bad claims", v.name, claims.ExpiresAt, err)
+		}
+		codec.Implicit = []byte("x")
+		if err = codec.Decode(v.token, &claims); err != ErrTokenVerificationFailed {
+			t.Error("implicit assertion mismatch accepted", v.name, err)
+		}
+	}
+
+	old := pasetoNonce
+	defer func() { pasetoNonce = old }()
+	nonce := mustHex(t, pasetoV4LocalVectors[0].nonce)
+	pasetoNonce = func(n []byte) error {
+		copy(n, nonce)
+		return nil
+	}
+	codec, _ := NewPasetoV4Local(key)
+	token, err := codec.Encode(&CustomClaims{})
+	if err != nil || !strings.HasPrefix(token, pasetoV4LocalVectors[0].token[:len(pasetoV4LocalHeader)+42]) {
+		t.Error("nonce not used", token, err)
+	}
+}
+
+func TestPasetoV4PublicVectors(t *testing.T) {
+	for _, v := range pasetoV4PublicVectors {
+		codec, err := NewPasetoV4Public(mustHex(t, v.secretKey), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(codec.pubKey, mustHex(t, v.publicKey)) {
+			t.Error("bad public key", v.name)
+		}
+		if token := codec.sign([]byte(v.payload)); token != v.token {
+			t.Error("bad token", v.name, token)
+		}
+
+		verifier, err := NewPasetoV4Public(nil, mustHex(t, v.publicKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m, err := verifier.verify(v.token); err != nil || string(m) != v.payload {
+			t.Error("bad payload", v.name, string(m), err)
+		}
+		var claims CustomClaims
+		if err = verifier.Decode(v.token, &claims); err != nil || claims.ExpiresAt != 1640995200 {
+			t.Error("bad claims", v.name, claims.ExpiresAt, err)
+		}
+		verifier.Implicit = []byte("x")
+		if err = verifier.Decode(v.token, &claims); err != ErrTokenVerificationFailed {
+			t.Error("implicit assertion mismatch accepted", v.name, err)
+		}
+	}
+}
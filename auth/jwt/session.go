@@ -0,0 +1,184 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sort"
+	"time"
+)
+
+// SessionLimitPolicy decides what happens to a new login when the subject
+// already has MaxSessions active sessions
+type SessionLimitPolicy int
+
+const (
+	// EvictOldestSession revokes the oldest sessions to make room for the new one
+	EvictOldestSession SessionLimitPolicy = iota
+	// RejectNewSession fails the login with ErrTooManySessions
+	RejectNewSession
+)
+
+// Session records a refresh token family, i.e. a login on one device.
+// The family id is stored in the jti claim of the tokens of the session
+type Session struct {
+	FamilyID  string    `json:"family_id"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpireAt  time.Time `json:"expire_at"`
+}
+
+// SessionStore tracks the sessions per subject
+type SessionStore interface {
+	// AddSession adds the session if the subject has less than maxSessions
+	// active sessions, or applies the policy otherwise. It must be atomic so
+	// that the concurrent logins could not exceed the limit, which is not
+	// enforced if maxSessions is not positive
+	AddSession(session *Session, maxSessions int, policy SessionLimitPolicy) error
+	// ListSessions return the unexpired sessions of the subject
+	ListSessions(sub string) ([]*Session, error)
+	// RemoveSession return ErrSessionNotFound if the session is missing
+	RemoveSession(sub, familyID string) error
+}
+
+// ListSessions return the active sessions of the subject, oldest first
+func (middleware *Middleware) ListSessions(sub string) ([]*Session, error) {
+	if middleware.Sessions == nil {
+		return nil, ErrMissingSessionStore
+	}
+	sessions, err := middleware.Sessions.ListSessions(sub)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// RevokeSession revokes the session so that neither its refresh token nor its access
+// tokens are accepted any more
+func (middleware *Middleware) RevokeSession(sub, familyID string) error {
+	if middleware.Sessions == nil {
+		return ErrMissingSessionStore
+	}
+	return middleware.Sessions.RemoveSession(sub, familyID)
+}
+
+func (middleware *Middleware) subject(field interface{}) string {
+	if middleware.SubjectFunc == nil {
+		return ""
+	}
+	return middleware.SubjectFunc(field)
+}
+
+// openSession enforces the session limit of the subject and return the id of the new session,
+// the tokens of an empty subject given by SubjectFunc have no session
+func (middleware *Middleware) openSession(sub string) (string, error) {
+	if middleware.Sessions == nil {
+		return "", nil
+	}
+	if middleware.SubjectFunc == nil {
+		return "", ErrMissingSubjectFunc
+	}
+	if len(sub) == 0 {
+		return "", nil
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	now := TimeFunc()
+	session := &Session{
+		FamilyID:  base64.RawURLEncoding.EncodeToString(b),
+		Subject:   sub,
+		CreatedAt: now,
+		ExpireAt:  now.Add(time.Duration(middleware.RefreshSecond) * time.Second),
+	}
+	if err := middleware.Sessions.AddSession(session, middleware.MaxSessions, middleware.SessionLimitPolicy); err != nil {
+		return "", err
+	}
+	return session.FamilyID, nil
+}
+
+func (middleware *Middleware) closeSession(sub, familyID string) {
+	if len(familyID) != 0 {
+		_ = middleware.Sessions.RemoveSession(sub, familyID)
+	}
+}
+
+// checkSession rejects the claims whose session has been revoked or evicted
+func (middleware *Middleware) checkSession(claims *CustomClaims) error {
+	if middleware.Sessions == nil || len(claims.Subject) == 0 || len(claims.Id) == 0 {
+		return nil
+	}
+	sessions, err := middleware.Sessions.ListSessions(claims.Subject)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.FamilyID == claims.Id {
+			return nil
+		}
+	}
+	return ErrSessionRevoked
+}
+
+func (store *MemoryTokenStore) AddSession(session *Session, maxSessions int, policy SessionLimitPolicy) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	families, ok := store.sessions[session.Subject]
+	if !ok {
+		families = make(map[string]*Session)
+		store.sessions[session.Subject] = families
+	}
+
+	now := TimeFunc()
+	active := make([]*Session, 0, len(families))
+	for familyID, family := range families {
+		if family.ExpireAt.Before(now) {
+			delete(families, familyID)
+		} else {
+			active = append(active, family)
+		}
+	}
+	if maxSessions > 0 && len(active) >= maxSessions {
+		if policy == RejectNewSession {
+			return ErrTooManySessions
+		}
+		sort.Slice(active, func(i, j int) bool {
+			return active[i].CreatedAt.Before(active[j].CreatedAt)
+		})
+		for _, family := range active[:len(active)-maxSessions+1] {
+			delete(families, family.FamilyID)
+		}
+	}
+	families[session.FamilyID] = session
+	return nil
+}
+
+func (store *MemoryTokenStore) ListSessions(sub string) ([]*Session, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	now := TimeFunc()
+	sessions := make([]*Session, 0, len(store.sessions[sub]))
+	for _, session := range store.sessions[sub] {
+		if !session.ExpireAt.Before(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (store *MemoryTokenStore) RemoveSession(sub, familyID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.sessions[sub][familyID]; !ok {
+		return ErrSessionNotFound
+	}
+	delete(store.sessions[sub], familyID)
+	if len(store.sessions[sub]) == 0 {
+		delete(store.sessions, sub)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newSessionMiddleware(policy SessionLimitPolicy) *Middleware {
+	mw := newCodecMiddleware(nil)
+	mw.RefreshSecond = 60
+	mw.SubjectFunc = func(field interface{}) string {
+		return strconv.Itoa(field.(*codecField).UID)
+	}
+	mw.Sessions = NewMemoryTokenStore()
+	mw.MaxSessions = 2
+	mw.SessionLimitPolicy = policy
+	return mw
+}
+
+func refreshWith(mw *Middleware, refreshToken string) error {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/refresh", nil)
+	c.Request.Header.Set("Authorization", "Bearer "+refreshToken)
+	_, err := mw.RefreshToken(c)
+	return err
+}
+
+func TestMiddleware_EvictOldestSession(t *testing.T) {
+	mw := newSessionMiddleware(EvictOldestSession)
+
+	var refreshTokens []string
+	for i := 0; i < 3; i++ {
+		_, rs, err := mw.GenerateTokenWithRefreshToken(&codecField{UID: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		refreshTokens = append(refreshTokens, rs)
+	}
+
+	sessions, err := mw.ListSessions("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatal("bad session count", len(sessions))
+	}
+
+	if err = refreshWith(mw, refreshTokens[0]); err != ErrSessionRevoked {
+		t.Error("evicted session refreshed", err)
+	}
+	if err = refreshWith(mw, refreshTokens[2]); err != nil {
+		t.Error(err)
+	}
+
+	if err = mw.RevokeSession("1", sessions[1].FamilyID); err != nil {
+		t.Fatal(err)
+	}
+	if err = refreshWith(mw, refreshTokens[2]); err != ErrSessionRevoked {
+		t.Error("revoked session refreshed", err)
+	}
+}
+
+func TestMiddleware_RevokedAccessToken(t *testing.T) {
+	mw := newSessionMiddleware(EvictOldestSession)
+	r := gin.New()
+	r.Use(mw.Build())
+	r.GET("/ping", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"pong": ""})
+	})
+	ping := func(token string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	var tokens []string
+	for i := 0; i < 3; i++ {
+		token, _, err := mw.GenerateTokenWithRefreshToken(&codecField{UID: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+	if code := ping(tokens[0]); code != http.StatusUnauthorized {
+		t.Error("evicted session accepted", code)
+	}
+	if code := ping(tokens[2]); code != http.StatusOK {
+		t.Error("bad code", code)
+	}
+
+	sessions, err := mw.ListSessions("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mw.RevokeSession("1", sessions[1].FamilyID); err != nil {
+		t.Fatal(err)
+	}
+	if code := ping(tokens[2]); code != http.StatusUnauthorized {
+		t.Error("revoked session accepted", code)
+	}
+
+	// the tokens without session are not looked up
+	token, err := mw.GenerateToken(&codecField{UID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := ping(token); code != http.StatusOK {
+		t.Error("bad code", code)
+	}
+}
+
+func TestMiddleware_RejectNewSession(t *testing.T) {
+	mw := newSessionMiddleware(RejectNewSession)
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := mw.GenerateTokenWithRefreshToken(&codecField{UID: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := mw.GenerateTokenWithRefreshToken(&codecField{UID: 1}); err != ErrTooManySessions {
+		t.Error("session limit exceeded", err)
+	}
+	if _, _, err := mw.GenerateTokenWithRefreshToken(&codecField{UID: 2}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMiddleware_MissingSubjectFunc(t *testing.T) {
+	mw := newSessionMiddleware(RejectNewSession)
+	mw.SubjectFunc = nil
+	if _, _, err := mw.GenerateTokenWithRefreshToken(&codecField{UID: 1}); err != ErrMissingSubjectFunc {
+		t.Error("session limit is not enforced without subject", err)
+	}
+}
+
+func TestMiddleware_ConcurrentSessions(t *testing.T) {
+	for _, policy := range []SessionLimitPolicy{RejectNewSession, EvictOldestSession} {
+		mw := newSessionMiddleware(policy)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _, err := mw.GenerateTokenWithRefreshToken(&codecField{UID: 1})
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		opened := 0
+		for err := range errs {
+			if err == nil {
+				opened++
+			} else if err != ErrTooManySessions {
+				t.Fatal(err)
+			}
+		}
+		if policy == RejectNewSession && opened != mw.MaxSessions {
+			t.Error("bad opened sessions", opened)
+		}
+		if sessions, _ := mw.ListSessions("1"); len(sessions) != mw.MaxSessions {
+			t.Error("session limit exceeded", policy, len(sessions))
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package jwt
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// TenantResolver return the tenant that the request belongs to,
+// e.g. by the request host or a header
+type TenantResolver func(c *gin.Context) (tenantID string)
+
+// TenantLookup return the key settings of the tenant
+type TenantLookup func(tenantID string) (*Tenant, error)
+
+// Tenant records the key settings of a tenant
+type Tenant struct {
+	// Issuer is required, it tells the tenants sharing a key apart
+	Issuer     string
+	SigningKey []byte
+
+	// Codec of the tenant, the Codec of the middleware is kept if it is nil, or a
+	// JSON Web Token signed by SigningKey is used if the middleware has none. Note
+	// that a codec with its own key, e.g. PASETO, is shared by such tenants
+	Codec TokenCodec
+}
+
+// StaticTenants return a TenantLookup over a fixed set of tenants
+func StaticTenants(tenants map[string]*Tenant) TenantLookup {
+	return func(tenantID string) (*Tenant, error) {
+		if tenant, ok := tenants[tenantID]; ok {
+			return tenant, nil
+		}
+		return nil, ErrUnknownTenant
+	}
+}
+
+// ForTenant return a copy of the middleware with the key settings of the tenant,
+// the copy generates tokens issued by the tenant, e.g.
+//     tenantMW, err := middleware.ForTenant(tenantID)
+//     token, err := tenantMW.GenerateToken(field)
+func (middleware *Middleware) ForTenant(tenantID string) (*Middleware, error) {
+	if middleware.TenantLookup == nil {
+		return nil, ErrMissingTenantLookup
+	}
+	tenant, err := middleware.TenantLookup(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if len(tenant.Issuer) == 0 {
+		return nil, ErrMissingTenantIssuer
+	}
+
+	tenantMiddleware := *middleware
+	tenantMiddleware.Issuer = tenant.Issuer
+	tenantMiddleware.SigningKeyString = string(tenant.SigningKey)
+	tenantMiddleware.SigningKey = tenant.SigningKey
+	if tenant.Codec != nil {
+		tenantMiddleware.Codec = tenant.Codec
+	}
+	tenantMiddleware.TenantResolver = nil
+	tenantMiddleware.TenantLookup = nil
+	return &tenantMiddleware, nil
+}
+
+// resolveTenant return the middleware of the tenant that the request belongs to,
+// or the middleware itself if the tenants are not enabled
+func (middleware *Middleware) resolveTenant(c *gin.Context) (*Middleware, error) {
+	if middleware.TenantResolver == nil {
+		return middleware, nil
+	}
+	return middleware.ForTenant(middleware.TenantResolver(c))
+}
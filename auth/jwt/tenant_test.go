@@ -0,0 +1,81 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware_ForTenant(t *testing.T) {
+	mw := NewMiddleWare(func() *CustomClaims {
+		return new(CustomClaims)
+	}, func(c *gin.Context, cc *CustomClaims) error {
+		return nil
+	})
+	mw.ExpireSecond = 60
+	mw.TenantResolver = func(c *gin.Context) string {
+		return c.GetHeader("X-Tenant")
+	}
+	mw.TenantLookup = StaticTenants(map[string]*Tenant{
+		"a": {Issuer: "tenant-a", SigningKey: []byte("key-a")},
+		"b": {Issuer: "tenant-b", SigningKey: []byte("key-b")},
+		// shares the key of a, so only the issuer tells them apart
+		"c": {Issuer: "tenant-c", SigningKey: []byte("key-a")},
+		"e": {SigningKey: []byte("key-e")},
+	})
+
+	tenantMW, err := mw.ForTenant("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := tenantMW.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the issuer would fall back to the signing key
+	if _, err = mw.ForTenant("e"); err != ErrMissingTenantIssuer {
+		t.Error("tenant without issuer", err)
+	}
+
+	r := gin.New()
+	r.Use(mw.Build())
+	r.GET("/ping", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"pong": ""})
+	})
+
+	for tenant, code := range map[string]int{
+		"a": http.StatusOK,
+		"b": http.StatusUnauthorized,
+		"c": http.StatusUnauthorized,
+		"d": http.StatusUnauthorized,
+		"e": http.StatusUnauthorized,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-Tenant", tenant)
+		r.ServeHTTP(w, req)
+		if w.Code != code {
+			t.Error("bad code", tenant, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestMiddleware_ForTenantCodec(t *testing.T) {
+	codec, tenantCodec := NewOpaqueCodec(NewMemoryTokenStore()), NewOpaqueCodec(NewMemoryTokenStore())
+	mw := newCodecMiddleware(codec)
+	mw.TenantLookup = StaticTenants(map[string]*Tenant{
+		"a": {Issuer: "tenant-a", SigningKey: []byte("key-a")},
+		"b": {Issuer: "tenant-b", SigningKey: []byte("key-b"), Codec: tenantCodec},
+	})
+
+	// the tenant without codec keeps the one of the middleware instead of switching to jwt
+	if tenantMW, err := mw.ForTenant("a"); err != nil || tenantMW.Codec != TokenCodec(codec) {
+		t.Error("codec of the middleware replaced", err)
+	}
+	if tenantMW, err := mw.ForTenant("b"); err != nil || tenantMW.Codec != TokenCodec(tenantCodec) {
+		t.Error("codec of the tenant ignored", err)
+	}
+}
@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AuditRecord is a change of the policy with the whole policy before and after it
+type AuditRecord struct {
+	ID     int64     `json:"id"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	Time   time.Time `json:"time"`
+	Before Snapshot  `json:"before"`
+	After  Snapshot  `json:"after"`
+}
+
+// Diff return the change made by the record
+func (record *AuditRecord) Diff() *Diff {
+	return DiffSnapshots(record.Before, record.After)
+}
+
+// AuditStore keeps the audit records, e.g. in a table of the database
+type AuditStore interface {
+	// AddRecord saves the record and sets its ID
+	AddRecord(record *AuditRecord) error
+	// ListRecords return a page of the records, the newest first
+	ListRecords(offset, limit int) (records []*AuditRecord, total int64, err error)
+	// GetRecord return the record or ErrRecordNotFound
+	GetRecord(id int64) (*AuditRecord, error)
+}
+
+// Audited runs the mutation of the policy on behalf of the actor, the policy before
+// and after it is recorded into the Audit store if the mutation changed the policy.
+// The audited mutations are serialised so the snapshots belong to the mutation, e.g.
+//
+//	mgr.Audited(actor, "add rule", func() (bool, error) {
+//		return mgr.AddPolicy("alice", "/data", "read")
+//	})
+func (mgr *Manager) Audited(actor, action string, mutation func() (changed bool, err error)) (bool, error) {
+	if mgr.Audit == nil {
+		return mutation()
+	}
+	mgr.auditMutex.Lock()
+	defer mgr.auditMutex.Unlock()
+
+	before, err := mgr.Export()
+	if err != nil {
+		return false, err
+	}
+	changed, err := mutation()
+	if !changed {
+		return changed, err
+	}
+
+	after, exportErr := mgr.Export()
+	if exportErr != nil {
+		return changed, exportErr
+	}
+	record := &AuditRecord{
+		Actor:  actor,
+		Action: action,
+		Time:   time.Now(),
+		Before: before,
+		After:  after,
+	}
+	if auditErr := mgr.Audit.AddRecord(record); auditErr != nil {
+		return changed, auditErr
+	}
+	return changed, err
+}
+
+// Rollback applies the policy before the change of the record on behalf of the actor
+func (mgr *Manager) Rollback(actor string, id int64) (*Diff, error) {
+	if mgr.Audit == nil {
+		return nil, ErrMissingAuditStore
+	}
+	record, err := mgr.Audit.GetRecord(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var diff *Diff
+	_, err = mgr.Audited(actor, fmt.Sprintf("rollback to %d", id), func() (bool, error) {
+		var err error
+		diff, err = mgr.Apply(record.Before)
+		return diff != nil && !diff.Empty(), err
+	})
+	return diff, err
+}
+
+// MemoryAuditStore is an AuditStore in the memory of a single instance
+type MemoryAuditStore struct {
+	mutex   sync.RWMutex
+	records []*AuditRecord
+}
+
+// NewMemoryAuditStore return an empty MemoryAuditStore
+func NewMemoryAuditStore() *MemoryAuditStore {
+	return new(MemoryAuditStore)
+}
+
+// AddRecord implements AuditStore
+func (store *MemoryAuditStore) AddRecord(record *AuditRecord) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	record.ID = int64(len(store.records) + 1)
+	store.records = append(store.records, record)
+	return nil
+}
+
+// ListRecords implements AuditStore
+func (store *MemoryAuditStore) ListRecords(offset, limit int) ([]*AuditRecord, int64, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	if offset < 0 {
+		offset = 0
+	}
+	var records []*AuditRecord
+	for i := len(store.records) - 1 - offset; i >= 0 && len(records) < limit; i-- {
+		records = append(records, store.records[i])
+	}
+	return records, int64(len(store.records)), nil
+}
+
+// GetRecord implements AuditStore
+func (store *MemoryAuditStore) GetRecord(id int64) (*AuditRecord, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	if id < 1 || id > int64(len(store.records)) {
+		return nil, ErrRecordNotFound
+	}
+	return store.records[id-1], nil
+}
@@ -0,0 +1,32 @@
+package policy
+
+import "errors"
+
+var (
+	// ErrInvalidArguments indicates a matcher function got arguments of unexpected count or types
+	ErrInvalidArguments = errors.New("invalid arguments of matcher function")
+
+	// ErrInvalidTimeWindow indicates the window of timeWindow is not like "09:00-18:00 Mon-Fri"
+	ErrInvalidTimeWindow = errors.New("invalid time window")
+
+	// ErrUnknownPolicyType indicates the ptype is not defined by the model
+	ErrUnknownPolicyType = errors.New("unknown policy type")
+
+	// ErrInvalidRule indicates the rule does not have a value for every field of the ptype
+	ErrInvalidRule = errors.New("invalid rule")
+
+	// ErrInvalidPage indicates the page or the page size of the listing is out of range
+	ErrInvalidPage = errors.New("invalid page")
+
+	// ErrRuleExists indicates the rule to add already exists
+	ErrRuleExists = errors.New("rule already exists")
+
+	// ErrRuleNotFound indicates the rule to change does not exist
+	ErrRuleNotFound = errors.New("rule not found")
+
+	// ErrMissingAuditStore indicates the rollback is called on a Manager without Audit
+	ErrMissingAuditStore = errors.New("missing audit store")
+
+	// ErrRecordNotFound indicates the audit record does not exist
+	ErrRecordNotFound = errors.New("audit record not found")
+)
@@ -0,0 +1,206 @@
+package policy
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// Function is a custom matcher function of casbin, i.e. govaluate.ExpressionFunction
+type Function = func(args ...interface{}) (interface{}, error)
+
+// Functions are the built-in matcher functions, register them on every enforcer, e.g.
+//
+//	for name, function := range policy.Functions {
+//		enforcer.AddFunction(name, function)
+//	}
+//
+// and match on the attributes passed by privileger in ABAC mode, e.g.
+//
+//	m = g(r.sub, p.sub) && keyMatch2(r.obj, p.obj) && r.act == p.act && ipMatch(r.attr.ClientIP, p.cidr) && timeWindow(r.attr.Time, p.hours)
+var Functions = map[string]Function{
+	"ipMatch":    IPMatch,
+	"timeWindow": TimeWindow,
+}
+
+// IPMatch is the matcher function ipMatch(ip, networks...), it returns true if the ip
+// is in any of the networks, each network is a CIDR, an IP or "*" for any address,
+// a comma separated list is accepted so that a policy field may hold several networks
+func IPMatch(args ...interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return false, ErrInvalidArguments
+	}
+	strs, err := stringArgs(args)
+	if err != nil {
+		return false, err
+	}
+	ip := net.ParseIP(strs[0])
+
+	for _, network := range splitList(strs[1:]) {
+		if network == "*" {
+			return true, nil
+		}
+		if ip == nil {
+			continue
+		}
+		if strings.Contains(network, "/") {
+			_, ipNet, err := net.ParseCIDR(network)
+			if err != nil {
+				return false, err
+			}
+			if ipNet.Contains(ip) {
+				return true, nil
+			}
+		} else if ip.Equal(net.ParseIP(network)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// TimeWindow is the matcher function timeWindow(t, window...), it returns true if the
+// time.Time or RFC3339 string t is in the window like "09:00-18:00", "22:00-06:00 Sat,Sun"
+// or "09:00-18:00", "Mon-Fri". The window is in UTC whatever the location of t is,
+// and "*" means any time
+func TimeWindow(args ...interface{}) (interface{}, error) {
+	return timeWindow(time.UTC, args)
+}
+
+// TimeWindowIn return the matcher function timeWindow with the windows in the location,
+// register it in place of the UTC one before enforcing, e.g.
+//
+//	loc, err := time.LoadLocation("Asia/Shanghai")
+//	mgr.AddFunction("timeWindow", policy.TimeWindowIn(loc))
+func TimeWindowIn(loc *time.Location) Function {
+	return func(args ...interface{}) (interface{}, error) {
+		return timeWindow(loc, args)
+	}
+}
+
+func timeWindow(loc *time.Location, args []interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return false, ErrInvalidArguments
+	}
+	var t time.Time
+	switch at := args[0].(type) {
+	case time.Time:
+		t = at
+	case string:
+		var err error
+		if t, err = time.Parse(time.RFC3339, at); err != nil {
+			return false, err
+		}
+	default:
+		return false, ErrInvalidArguments
+	}
+	t = t.In(loc)
+	strs, err := stringArgs(args[1:])
+	if err != nil {
+		return false, err
+	}
+
+	fields := strings.Fields(strings.Join(strs, " "))
+	if len(fields) == 1 && fields[0] == "*" {
+		return true, nil
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		return false, ErrInvalidTimeWindow
+	}
+	if len(fields) == 2 {
+		days, err := parseWeekdays(fields[1])
+		if err != nil {
+			return false, err
+		}
+		if !days[t.Weekday()] {
+			return false, nil
+		}
+	}
+
+	clock := strings.Split(fields[0], "-")
+	if len(clock) != 2 {
+		return false, ErrInvalidTimeWindow
+	}
+	start, err := parseClock(clock[0])
+	if err != nil {
+		return false, err
+	}
+	end, err := parseClock(clock[1])
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if start <= end {
+		return start <= now && now < end, nil
+	}
+	// the window crosses midnight
+	return now >= start || now < end, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// parseWeekdays parses the days like "Mon-Fri" or "Sat,Sun"
+func parseWeekdays(s string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		bounds := strings.Split(part, "-")
+		first, ok := weekdays[bounds[0]]
+		if !ok || len(bounds) > 2 {
+			return nil, ErrInvalidTimeWindow
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[bounds[1]]; !ok {
+				return nil, ErrInvalidTimeWindow
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock parses the clock like "09:00" into the duration since midnight
+func parseClock(s string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, ErrInvalidTimeWindow
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+func stringArgs(args []interface{}) ([]string, error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := arg.(string)
+		if !ok {
+			return nil, ErrInvalidArguments
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+func splitList(strs []string) []string {
+	var list []string
+	for _, s := range strs {
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); len(item) != 0 {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,84 @@
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIPMatch(t *testing.T) {
+	for _, tc := range []struct {
+		args    []interface{}
+		allowed bool
+		err     bool
+	}{
+		{[]interface{}{"10.1.2.3", "10.0.0.0/8"}, true, false},
+		{[]interface{}{"10.1.2.3", "192.168.0.0/16, 10.0.0.0/8"}, true, false},
+		{[]interface{}{"10.1.2.3", "192.168.0.0/16", "10.1.2.3"}, true, false},
+		{[]interface{}{"172.16.0.1", "10.0.0.0/8"}, false, false},
+		{[]interface{}{"", "10.0.0.0/8"}, false, false},
+		{[]interface{}{"", "*"}, true, false},
+		{[]interface{}{"::1", "::1/128"}, true, false},
+		{[]interface{}{"10.1.2.3", "10.0.0.0/33"}, false, true},
+		{[]interface{}{"10.1.2.3"}, false, true},
+		{[]interface{}{"10.1.2.3", 8}, false, true},
+	} {
+		allowed, err := IPMatch(tc.args...)
+		if allowed != tc.allowed || (err != nil) != tc.err {
+			t.Error("bad match", tc.args, allowed, err)
+		}
+	}
+}
+
+func TestTimeWindow(t *testing.T) {
+	// 2019-11-01 is a Friday
+	friday := time.Date(2019, 11, 1, 10, 30, 0, 0, time.UTC)
+	night := time.Date(2019, 11, 2, 23, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		args    []interface{}
+		allowed bool
+		err     bool
+	}{
+		{[]interface{}{friday, "09:00-18:00"}, true, false},
+		{[]interface{}{friday, "09:00-18:00 Mon-Fri"}, true, false},
+		{[]interface{}{friday, "09:00-18:00", "Sat,Sun"}, false, false},
+		{[]interface{}{friday, "11:00-18:00"}, false, false},
+		{[]interface{}{friday, "*"}, true, false},
+		{[]interface{}{friday.Format(time.RFC3339), "10:30-10:31"}, true, false},
+		{[]interface{}{night, "22:00-06:00 Fri-Sun"}, true, false},
+		{[]interface{}{night, "22:00-06:00 Mon-Fri"}, false, false},
+		{[]interface{}{night, "06:00-22:00"}, false, false},
+		{[]interface{}{friday, "9-18"}, false, true},
+		{[]interface{}{friday, "09:00-18:00 Someday"}, false, true},
+		{[]interface{}{42, "09:00-18:00"}, false, true},
+	} {
+		allowed, err := TimeWindow(tc.args...)
+		if allowed != tc.allowed || (err != nil) != tc.err {
+			t.Error("bad match", tc.args, allowed, err)
+		}
+	}
+}
+
+func TestTimeWindowIn(t *testing.T) {
+	// 2019-10-31 23:30 UTC is the Friday morning 07:30 in UTC+8
+	shanghai := time.FixedZone("CST", 8*60*60)
+	thursday := time.Date(2019, 10, 31, 23, 30, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		timeWindow Function
+		t          interface{}
+		window     string
+		allowed    bool
+	}{
+		{TimeWindow, thursday, "07:00-08:00 Fri", false},
+		{TimeWindow, thursday, "23:00-00:00 Thu", true},
+		{TimeWindow, thursday.In(shanghai), "23:00-00:00 Thu", true},
+		{TimeWindow, thursday.In(shanghai).Format(time.RFC3339), "23:00-00:00 Thu", true},
+		{TimeWindowIn(shanghai), thursday, "07:00-08:00 Fri", true},
+		{TimeWindowIn(shanghai), thursday, "23:00-00:00 Thu", false},
+		{TimeWindowIn(shanghai), thursday.Format(time.RFC3339), "07:00-08:00 Fri", true},
+	} {
+		allowed, err := tc.timeWindow(tc.t, tc.window)
+		if allowed != tc.allowed || err != nil {
+			t.Error("bad match", tc.t, tc.window, allowed, err)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/govaluate"
+)
+
+// Severity of a lint issue, the errors break the enforcement at request time
+// and the warnings are likely mistakes
+type Severity string
+
+// The severities of the lint issues
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a problem of the model or a rule found by Lint
+type Issue struct {
+	Severity Severity `json:"severity"`
+	PType    string   `json:"ptype,omitempty"`
+	Rule     []string `json:"rule,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func (issue Issue) String() string {
+	if len(issue.PType) == 0 {
+		return fmt.Sprintf("%s: %s", issue.Severity, issue.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", issue.Severity, strings.Join(append([]string{issue.PType}, issue.Rule...), ", "), issue.Message)
+}
+
+// HasErrors reports whether any of the issues is an error
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Lint checks the model and the policy, it reports
+//
+//   - the matchers failing to compile or referring to unknown fields or functions
+//   - the rules of unknown ptypes or with missing fields
+//   - the patterns failing to compile, e.g. an invalid regexp of regexMatch
+//   - the rules matching every object and action of the subject
+//   - the rules shadowed by another rule granting the same or more, and the
+//     rules never taking effect under the policy effect of the model
+//   - the cycles of role inheritance
+//
+// The custom functions added to the enforcer should be given to check the matchers, e.g.
+//
+//	issues := policy.Lint(m, snapshot, nil)
+//	if policy.HasErrors(issues) {
+//		t.Fatal(issues)
+//	}
+func Lint(m model.Model, snapshot Snapshot, functions map[string]Function) []Issue {
+	linter := &linter{model: m, snapshot: snapshot, builtins: builtinFunctions()}
+	linter.functions = make(map[string]govaluate.ExpressionFunction)
+	for name, function := range linter.builtins {
+		linter.functions[name] = function
+	}
+	for name, function := range functions {
+		linter.functions[name] = function
+	}
+	linter.lintMatchers()
+	linter.lintRules()
+	linter.lintRoles()
+	return linter.issues
+}
+
+// Lint checks the model and the policy of the manager
+func (mgr *Manager) Lint() ([]Issue, error) {
+	snapshot, err := mgr.Export()
+	if err != nil {
+		return nil, err
+	}
+	return Lint(mgr.enforcer.GetModel(), snapshot, mgr.functions), nil
+}
+
+// LintFiles checks the model file and the policy file in CSV or JSON
+func LintFiles(modelPath, policyPath string, functions map[string]Function) ([]Issue, error) {
+	m, err := model.NewModelFromFile(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(policyPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var snapshot Snapshot
+	if filepath.Ext(policyPath) == ".json" {
+		snapshot, err = ReadJSON(f)
+	} else {
+		snapshot, err = ReadCSV(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Lint(m, snapshot, functions), nil
+}
+
+var (
+	// callPattern matches the function calls of the matcher
+	callPattern = regexp.MustCompile(`\b([A-Za-z_]\w*)\s*\(`)
+	// patternFieldPattern matches the fields of rule used as a pattern, e.g. keyMatch2(r_obj, p_obj)
+	patternFieldPattern = regexp.MustCompile(`\b(\w+)\s*\(\s*r\d*_[\w.]+\s*,\s*(p\d*_\w+)\s*[,)]`)
+)
+
+// lintProbes are the values hardly matched by a pattern unless it matches everything
+var lintProbes = []interface{}{"", "\x00lint-probe", "/lint/probe/\x00", "LINT.PROBE"}
+
+// lintProbesOf return the probes for the built-in functions which do not take strings
+func lintProbesOf(function string) []interface{} {
+	switch function {
+	case "ipMatch":
+		return []interface{}{"0.0.0.1", "127.0.0.1", "192.0.2.1", "255.255.255.254"}
+	case "timeWindow":
+		// a Sunday midnight, a Wednesday noon and a Saturday night
+		return []interface{}{
+			time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2006, 1, 4, 12, 30, 0, 0, time.UTC),
+			time.Date(2006, 1, 7, 23, 59, 0, 0, time.UTC),
+		}
+	}
+	return lintProbes
+}
+
+// builtinFunctions return the built-in functions of casbin and the package,
+// the custom functions are not known to match patterns so they are never probed
+func builtinFunctions() map[string]govaluate.ExpressionFunction {
+	functionMap := model.LoadFunctionMap()
+	builtins := functionMap.GetFunctions()
+	for name, function := range Functions {
+		builtins[name] = function
+	}
+	return builtins
+}
+
+type linter struct {
+	model     model.Model
+	snapshot  Snapshot
+	builtins  map[string]govaluate.ExpressionFunction
+	functions map[string]govaluate.ExpressionFunction
+	issues    []Issue
+}
+
+func (linter *linter) report(severity Severity, ptype string, rule []string, format string, args ...interface{}) {
+	linter.issues = append(linter.issues, Issue{
+		Severity: severity,
+		PType:    ptype,
+		Rule:     rule,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// lintMatchers compiles the matchers and checks the functions and the fields they use
+func (linter *linter) lintMatchers() {
+	variables := make(map[string]bool)
+	for _, sec := range []string{"r", "p"} {
+		for _, assertion := range linter.model[sec] {
+			for _, token := range assertion.Tokens {
+				variables[token] = true
+			}
+		}
+	}
+
+	for key, assertion := range linter.model["m"] {
+		functions := make(map[string]govaluate.ExpressionFunction)
+		for name, function := range linter.functions {
+			functions[name] = function
+		}
+		for _, call := range callPattern.FindAllStringSubmatch(assertion.Value, -1) {
+			name := call[1]
+			if _, ok := functions[name]; ok || name == "in" {
+				continue
+			}
+			if _, isRole := linter.model["g"][name]; !isRole && name != "eval" {
+				linter.report(SeverityWarning, "", nil, "matcher %s calls %s which is not a built-in function, add it to the enforcer", key, name)
+			}
+			functions[name] = nil
+		}
+
+		expression, err := govaluate.NewEvaluableExpressionWithFunctions(assertion.Value, functions)
+		if err != nil {
+			linter.report(SeverityError, "", nil, "matcher %s does not compile: %v", key, err)
+			continue
+		}
+		for _, token := range expression.Tokens() {
+			var name string
+			switch token.Kind {
+			case govaluate.VARIABLE:
+				name = token.Value.(string)
+			case govaluate.ACCESSOR:
+				name = token.Value.([]string)[0]
+			default:
+				continue
+			}
+			if !variables[name] {
+				linter.report(SeverityError, "", nil, "matcher %s refers to %s which is not defined", key, strings.Replace(name, "_", ".", 1))
+			}
+		}
+	}
+}
+
+// ruleFields is how the matchers use the fields of the rules of a ptype
+type ruleFields struct {
+	// patterns are the built-in functions matching the fields
+	patterns map[int][]string
+	// subject is the index of the field matched by a role, or -1
+	subject int
+	// roleType is the ptype of the role matching the subject
+	roleType string
+	// eft is the index of the effect field, or -1
+	eft int
+}
+
+func (linter *linter) fieldsOf(ptype string) ruleFields {
+	fields := ruleFields{patterns: make(map[int][]string), subject: -1, eft: -1}
+	tokens := linter.model["p"][ptype].Tokens
+	index := func(token string) int {
+		for i, t := range tokens {
+			if t == token {
+				return i
+			}
+		}
+		return -1
+	}
+	fields.eft = index(ptype + "_eft")
+
+	for _, assertion := range linter.model["m"] {
+		for _, match := range patternFieldPattern.FindAllStringSubmatch(assertion.Value, -1) {
+			i := index(match[2])
+			if i == -1 {
+				continue
+			}
+			if _, isRole := linter.model["g"][match[1]]; isRole {
+				fields.subject, fields.roleType = i, match[1]
+			} else if _, ok := linter.builtins[match[1]]; ok {
+				fields.patterns[i] = append(fields.patterns[i], match[1])
+			}
+		}
+	}
+	return fields
+}
+
+// lintRules checks the fields of every rule, the patterns and the shadowing between the rules
+func (linter *linter) lintRules() {
+	for _, ptype := range snapshotTypes(linter.snapshot) {
+		rules := linter.snapshot[ptype]
+		assertion, ok := linter.model[section(ptype)][ptype]
+		if !ok {
+			linter.report(SeverityError, ptype, nil, "ptype is not defined by the model, its %d rules are unreachable", len(rules))
+			continue
+		}
+
+		var valid [][]string
+		for _, rule := range rules {
+			if len(rule) != len(assertion.Tokens) {
+				linter.report(SeverityError, ptype, rule, "rule has %d fields, want %d", len(rule), len(assertion.Tokens))
+			} else if hasEmptyField(rule) {
+				linter.report(SeverityError, ptype, rule, "rule has an empty field")
+			} else {
+				valid = append(valid, rule)
+			}
+		}
+		if section(ptype) == "p" {
+			fields := linter.fieldsOf(ptype)
+			linter.lintPatterns(ptype, valid, fields)
+			linter.lintShadowing(ptype, valid, fields)
+		}
+	}
+}
+
+// lintPatterns compiles the patterns of the rules and reports the rules matching everything
+func (linter *linter) lintPatterns(ptype string, rules [][]string, fields ruleFields) {
+	if len(fields.patterns) == 0 {
+		return
+	}
+	for _, rule := range rules {
+		broad, valid := true, true
+		for i := range rule {
+			if i == fields.subject || i == fields.eft {
+				continue
+			}
+			functions, isPattern := fields.patterns[i]
+			broad = broad && isPattern
+			for _, function := range functions {
+				matchesAll, err := linter.matchesAll(function, rule[i])
+				if err != nil {
+					linter.report(SeverityError, ptype, rule, "%s pattern %q is invalid: %v", function, rule[i], err)
+					valid = false
+					continue
+				}
+				if matchesAll && function == "regexMatch" {
+					linter.report(SeverityWarning, ptype, rule, "regexp %q matches an empty string so it matches any value, anchor it like ^...$", rule[i])
+				}
+				broad = broad && matchesAll
+			}
+		}
+		if broad && valid {
+			linter.report(SeverityWarning, ptype, rule, "rule matches every request of its subject")
+		}
+	}
+}
+
+// matchesAll calls the function on the probes, the patterns panicking are invalid
+func (linter *linter) matchesAll(function, pattern string) (matchesAll bool, err error) {
+	matchesAll = true
+	for _, probe := range lintProbesOf(function) {
+		matched, err := linter.call(function, probe, pattern)
+		if err != nil {
+			return false, err
+		}
+		matchesAll = matchesAll && matched
+	}
+	return matchesAll, nil
+}
+
+func (linter *linter) call(function string, value interface{}, pattern string) (matched bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			matched, err = false, fmt.Errorf("%v", r)
+		}
+	}()
+	result, err := linter.functions[function](value, pattern)
+	if err != nil {
+		return false, err
+	}
+	matched, _ = result.(bool)
+	return matched, nil
+}
+
+// lintShadowing reports the rules granting nothing more than another rule,
+// and the rules never taking effect under the policy effect of the model
+func (linter *linter) lintShadowing(ptype string, rules [][]string, fields ruleFields) {
+	effect := strings.Replace(linter.model["e"]["e"].Value, " ", "", -1)
+	eft := func(rule []string) string {
+		if fields.eft == -1 {
+			return "allow"
+		}
+		return rule[fields.eft]
+	}
+
+	for i, rule := range rules {
+		if effect == "some(where(p_eft==allow))" && eft(rule) != "allow" {
+			linter.report(SeverityWarning, ptype, rule, "rule is unreachable, only the allow rules take effect")
+			continue
+		}
+		if hasRule(rules[:i], rule) {
+			linter.report(SeverityWarning, ptype, rule, "rule is duplicated")
+			continue
+		}
+
+		for j, other := range rules {
+			if i == j || equalRules(rule, other) || !linter.covers(other, rule, fields) {
+				continue
+			}
+			// report only one of the rules covering each other
+			if j > i && linter.covers(rule, other, fields) {
+				continue
+			}
+
+			switch {
+			case effect == "priority(p_eft)||deny" && j < i && eft(other) != eft(rule):
+				linter.report(SeverityWarning, ptype, rule, "rule is unreachable, %s decides first", strings.Join(other, ", "))
+			case effect == "some(where(p_eft==allow))&&!some(where(p_eft==deny))" &&
+				eft(other) == "deny" && eft(rule) == "allow":
+				linter.report(SeverityWarning, ptype, rule, "rule is unreachable, it is always denied by %s", strings.Join(other, ", "))
+			case eft(other) == eft(rule) && (effect != "priority(p_eft)||deny" || j < i):
+				linter.report(SeverityWarning, ptype, rule, "rule is shadowed by %s", strings.Join(other, ", "))
+			default:
+				continue
+			}
+			break
+		}
+	}
+}
+
+// covers reports whether the rule matches every request the other rule matches,
+// the patterns of the other rule are matched as values so it is a best guess
+func (linter *linter) covers(rule, other []string, fields ruleFields) bool {
+	for i := range rule {
+		if rule[i] == other[i] || i == fields.eft {
+			continue
+		}
+		if i == fields.subject {
+			if !linter.inherits(fields.roleType, other[i], rule[i]) {
+				return false
+			}
+			continue
+		}
+		functions, isPattern := fields.patterns[i]
+		if !isPattern {
+			return false
+		}
+		for _, function := range functions {
+			value := other[i]
+			if function == "regexMatch" {
+				value = strings.TrimSuffix(strings.TrimPrefix(value, "^"), "$")
+			}
+			if matched, err := linter.call(function, value, rule[i]); err != nil || !matched {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// inherits reports whether the member has the role through the role inheritance rules of ptype
+func (linter *linter) inherits(ptype, member, role string) bool {
+	visited := map[string]bool{member: true}
+	queue := []string{member}
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, rule := range linter.snapshot[ptype] {
+			if len(rule) != 2 || rule[0] != current || visited[rule[1]] {
+				continue
+			}
+			if rule[1] == role {
+				return true
+			}
+			visited[rule[1]] = true
+			queue = append(queue, rule[1])
+		}
+	}
+	return false
+}
+
+// lintRoles reports the cycles of role inheritance
+func (linter *linter) lintRoles() {
+	for _, ptype := range snapshotTypes(linter.snapshot) {
+		if section(ptype) != "g" {
+			continue
+		}
+		for _, rule := range linter.snapshot[ptype] {
+			if len(rule) == 2 && (rule[0] == rule[1] || linter.inherits(ptype, rule[1], rule[0])) {
+				linter.report(SeverityWarning, ptype, rule, "role inheritance has a cycle")
+			}
+		}
+	}
+}
+
+func hasEmptyField(rule []string) bool {
+	for _, field := range rule {
+		if len(strings.TrimSpace(field)) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func equalRules(rule, other []string) bool {
+	return strings.Join(rule, "\x00") == strings.Join(other, "\x00")
+}
+
+func hasRule(rules [][]string, rule []string) bool {
+	for _, other := range rules {
+		if equalRules(rule, other) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+const testRegexModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act, eft
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = g(r.sub, p.sub) && regexMatch(r.obj, p.obj) && regexMatch(r.act, p.act)
+`
+
+func lintMessages(issues []Issue) string {
+	var messages []string
+	for _, issue := range issues {
+		messages = append(messages, issue.String())
+	}
+	return strings.Join(messages, "\n")
+}
+
+func TestLint(t *testing.T) {
+	m, err := model.NewModelFromString(testRegexModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		snapshot Snapshot
+		errors   bool
+		messages []string
+	}{
+		{"clean", Snapshot{
+			"p": {{"admin", "^/api/users/[0-9]+$", "^(GET|PUT)$", "allow"}},
+			"g": {{"user:1", "admin"}},
+		}, false, nil},
+		{"match everything", Snapshot{
+			"p": {{"admin", `[\^]*`, `[\^]*`, "allow"}},
+		}, false, []string{"matches an empty string", "matches every request"}},
+		{"invalid regexp", Snapshot{
+			"p": {{"admin", "(", "GET", "allow"}},
+		}, true, []string{`regexMatch pattern "(" is invalid`}},
+		{"bad rules", Snapshot{
+			"p":  {{"admin", "^/a$"}, {"admin", "", "^GET$", "allow"}},
+			"p2": {{"admin", "^/a$", "^GET$"}},
+		}, true, []string{"has 2 fields, want 4", "has an empty field", "ptype is not defined"}},
+		{"shadowed", Snapshot{
+			"p": {
+				{"admin", "^/api/.*$", "^GET$", "allow"},
+				{"user:1", "^/api/users$", "^GET$", "allow"},
+				{"user:1", "^/api/users$", "^GET$", "allow"},
+				{"user:2", "^/api/orders$", "^GET$", "allow"},
+				{"user:2", "^/api/.*$", "^GET$", "deny"},
+			},
+			"g": {{"user:1", "admin"}},
+		}, false, []string{
+			"user:1, ^/api/users$, ^GET$, allow: rule is shadowed by admin",
+			"rule is duplicated",
+			"user:2, ^/api/orders$, ^GET$, allow: rule is unreachable, it is always denied",
+		}},
+		{"role cycle", Snapshot{
+			"g": {{"a", "b"}, {"b", "c"}, {"c", "a"}},
+		}, false, []string{"g, c, a: role inheritance has a cycle"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			issues := Lint(m, test.snapshot, nil)
+			if HasErrors(issues) != test.errors {
+				t.Error("bad errors", lintMessages(issues))
+			}
+			if len(test.messages) == 0 && len(issues) != 0 {
+				t.Error("unexpected issues", lintMessages(issues))
+			}
+			for _, message := range test.messages {
+				if !strings.Contains(lintMessages(issues), message) {
+					t.Errorf("missing issue %q in\n%s", message, lintMessages(issues))
+				}
+			}
+		})
+	}
+}
+
+func TestLint_Matchers(t *testing.T) {
+	m, err := model.NewModelFromString(strings.Replace(testModel,
+		"r.act == p.act", "r.act == p.action && isOwner(r.sub, p.obj) && ipMatch(r.sub, p.obj)", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := Lint(m, nil, nil)
+	if !HasErrors(issues) || !strings.Contains(lintMessages(issues), "refers to p.action") ||
+		!strings.Contains(lintMessages(issues), "calls isOwner") {
+		t.Error("bad matcher issues", lintMessages(issues))
+	}
+
+	isOwner := func(args ...interface{}) (interface{}, error) { return true, nil }
+	mgr, err := NewManagerFromString(strings.Replace(testModel,
+		"r.act == p.act", "r.act == p.act && isOwner(r.sub, p.obj)", 1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr.AddFunction("isOwner", isOwner)
+	if _, err = mgr.AddPolicy("admin", "/api/users/:id", "PUT"); err != nil {
+		t.Fatal(err)
+	}
+	if issues, err = mgr.Lint(); err != nil || len(issues) != 0 {
+		t.Error("bad manager issues", lintMessages(issues), err)
+	}
+}
@@ -0,0 +1,391 @@
+package policy
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// Manager is a concurrency safe casbin enforcer, it implements privileger.Validator
+// and replaces the package level enforcer every service used to keep, e.g.
+//
+//	mgr, err := policy.NewManagerFromFile("rbac.conf", adapter)
+//	authmw := privileger.NewMiddleWare(mgr, "user:", "uid")
+//	mgr.OnChange = authmw.Invalidate
+type Manager struct {
+	enforcer *casbin.SyncedEnforcer
+	adapter  persist.Adapter
+	autoSave bool
+
+	// functions are the custom matcher functions, kept for Lint
+	functions map[string]Function
+
+	// OnChange is called after the policy in memory is changed or loaded,
+	// e.g. privileger.MiddleWare.Invalidate to drop the cached decisions
+	OnChange func()
+
+	// OnSave is called after a change is saved by the adapter, e.g. to bump the
+	// version polled by the other instances, its error is returned by the change
+	OnSave func() error
+
+	// Audit records the changes made through Audited, e.g. by the policy routes
+	Audit      AuditStore
+	auditMutex sync.Mutex
+}
+
+// NewManager return the manager of the model and the policy in the adapter,
+// the adapter may be nil to keep the policy in memory only. The built-in
+// Functions are registered on the enforcer
+func NewManager(m model.Model, adapter persist.Adapter) (*Manager, error) {
+	var enforcer *casbin.SyncedEnforcer
+	var err error
+	if adapter == nil {
+		enforcer, err = casbin.NewSyncedEnforcer(m)
+	} else {
+		enforcer, err = casbin.NewSyncedEnforcer(m, adapter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for name, function := range Functions {
+		enforcer.AddFunction(name, function)
+	}
+	return &Manager{
+		enforcer:  enforcer,
+		adapter:   adapter,
+		autoSave:  true,
+		functions: make(map[string]Function),
+	}, nil
+}
+
+// NewManagerFromFile return the manager of the model in the file
+func NewManagerFromFile(modelPath string, adapter persist.Adapter) (*Manager, error) {
+	m, err := model.NewModelFromFile(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewManager(m, adapter)
+}
+
+// NewManagerFromString return the manager of the model text
+func NewManagerFromString(text string, adapter persist.Adapter) (*Manager, error) {
+	m, err := model.NewModelFromString(text)
+	if err != nil {
+		return nil, err
+	}
+	return NewManager(m, adapter)
+}
+
+// Enforcer return the underlying enforcer for the APIs not wrapped by the manager,
+// the changes made through it do not call the hooks
+func (mgr *Manager) Enforcer() *casbin.SyncedEnforcer {
+	return mgr.enforcer
+}
+
+// Enforce implements privileger.Validator
+func (mgr *Manager) Enforce(rvals ...interface{}) (bool, error) {
+	return mgr.enforcer.Enforce(rvals...)
+}
+
+// EnforceEx implements privileger.ExplainingValidator
+func (mgr *Manager) EnforceEx(rvals ...interface{}) (bool, []string, error) {
+	return mgr.enforcer.EnforceEx(rvals...)
+}
+
+// BatchEnforce implements privileger.BatchValidator
+func (mgr *Manager) BatchEnforce(requests [][]interface{}) ([]bool, error) {
+	return mgr.enforcer.BatchEnforce(requests)
+}
+
+// GetAllSubjects implements privileger.SubjectLister
+func (mgr *Manager) GetAllSubjects() ([]string, error) {
+	return mgr.enforcer.GetAllSubjects()
+}
+
+// GetAllRoles implements privileger.SubjectLister
+func (mgr *Manager) GetAllRoles() ([]string, error) {
+	return mgr.enforcer.GetAllRoles()
+}
+
+// AddFunction adds a custom matcher function
+func (mgr *Manager) AddFunction(name string, function Function) {
+	mgr.enforcer.AddFunction(name, function)
+	mgr.functions[name] = function
+}
+
+// EnableAutoSave controls whether the changes are saved to the adapter at once
+func (mgr *Manager) EnableAutoSave(autoSave bool) {
+	mgr.enforcer.EnableAutoSave(autoSave)
+	mgr.autoSave = autoSave
+}
+
+// LoadPolicy reloads the policy from the adapter
+func (mgr *Manager) LoadPolicy() error {
+	if err := mgr.enforcer.LoadPolicy(); err != nil {
+		return err
+	}
+	mgr.changed()
+	return nil
+}
+
+// SavePolicy saves the whole policy to the adapter
+func (mgr *Manager) SavePolicy() error {
+	if err := mgr.enforcer.SavePolicy(); err != nil {
+		return err
+	}
+	return mgr.saved()
+}
+
+// GetPolicy return the rules of "p"
+func (mgr *Manager) GetPolicy() ([][]string, error) {
+	return mgr.enforcer.GetPolicy()
+}
+
+// GetNamedPolicy return the rules of the ptype, e.g. "p2"
+func (mgr *Manager) GetNamedPolicy(ptype string) ([][]string, error) {
+	return mgr.enforcer.GetNamedPolicy(ptype)
+}
+
+// GetGroupingPolicy return the role inheritance rules of "g"
+func (mgr *Manager) GetGroupingPolicy() ([][]string, error) {
+	return mgr.enforcer.GetGroupingPolicy()
+}
+
+// GetNamedGroupingPolicy return the role inheritance rules of the ptype, e.g. "g2"
+func (mgr *Manager) GetNamedGroupingPolicy(ptype string) ([][]string, error) {
+	return mgr.enforcer.GetNamedGroupingPolicy(ptype)
+}
+
+// HasPolicy determines whether the rule of "p" exists
+func (mgr *Manager) HasPolicy(rule ...string) (bool, error) {
+	return mgr.enforcer.HasPolicy(rule)
+}
+
+// HasGroupingPolicy determines whether the role inheritance rule of "g" exists
+func (mgr *Manager) HasGroupingPolicy(rule ...string) (bool, error) {
+	return mgr.enforcer.HasGroupingPolicy(rule)
+}
+
+// AddPolicy adds a rule of "p", added is false if the rule already exists
+func (mgr *Manager) AddPolicy(rule ...string) (added bool, err error) {
+	return mgr.AddNamedPolicy("p", rule...)
+}
+
+// AddNamedPolicy adds a rule of the ptype
+func (mgr *Manager) AddNamedPolicy(ptype string, rule ...string) (added bool, err error) {
+	return mgr.notify(mgr.enforcer.AddNamedPolicy(ptype, rule))
+}
+
+// RemovePolicy removes a rule of "p", removed is false if the rule does not exist
+func (mgr *Manager) RemovePolicy(rule ...string) (removed bool, err error) {
+	return mgr.RemoveNamedPolicy("p", rule...)
+}
+
+// RemoveNamedPolicy removes a rule of the ptype
+func (mgr *Manager) RemoveNamedPolicy(ptype string, rule ...string) (removed bool, err error) {
+	return mgr.notify(mgr.enforcer.RemoveNamedPolicy(ptype, rule))
+}
+
+// RemoveFilteredPolicy removes the rules of "p" matching the field filters
+func (mgr *Manager) RemoveFilteredPolicy(fieldIndex int, fieldValues ...string) (removed bool, err error) {
+	return mgr.notify(mgr.enforcer.RemoveFilteredPolicy(fieldIndex, fieldValues...))
+}
+
+// AddGroupingPolicy adds a role inheritance rule of "g"
+func (mgr *Manager) AddGroupingPolicy(rule ...string) (added bool, err error) {
+	return mgr.AddNamedGroupingPolicy("g", rule...)
+}
+
+// AddNamedGroupingPolicy adds a role inheritance rule of the ptype
+func (mgr *Manager) AddNamedGroupingPolicy(ptype string, rule ...string) (added bool, err error) {
+	return mgr.notify(mgr.enforcer.AddNamedGroupingPolicy(ptype, rule))
+}
+
+// RemoveGroupingPolicy removes a role inheritance rule of "g"
+func (mgr *Manager) RemoveGroupingPolicy(rule ...string) (removed bool, err error) {
+	return mgr.RemoveNamedGroupingPolicy("g", rule...)
+}
+
+// RemoveNamedGroupingPolicy removes a role inheritance rule of the ptype
+func (mgr *Manager) RemoveNamedGroupingPolicy(ptype string, rule ...string) (removed bool, err error) {
+	return mgr.notify(mgr.enforcer.RemoveNamedGroupingPolicy(ptype, rule))
+}
+
+// RemoveFilteredGroupingPolicy removes the role inheritance rules of "g" matching the field filters
+func (mgr *Manager) RemoveFilteredGroupingPolicy(fieldIndex int, fieldValues ...string) (removed bool, err error) {
+	return mgr.notify(mgr.enforcer.RemoveFilteredGroupingPolicy(fieldIndex, fieldValues...))
+}
+
+// GetRolesForUser return the roles the user directly inherits by "g"
+func (mgr *Manager) GetRolesForUser(user string) ([]string, error) {
+	return mgr.enforcer.GetRolesForUser(user)
+}
+
+// GetUsersForRole return the users directly inheriting the role by "g"
+func (mgr *Manager) GetUsersForRole(role string) ([]string, error) {
+	return mgr.enforcer.GetUsersForRole(role)
+}
+
+// The Rule methods work on the rules of any ptype, the ptypes starting with "g"
+// are the role inheritance rules and the others are the policy rules
+
+// ValidatePolicyType checks the ptype is defined by the model
+func (mgr *Manager) ValidatePolicyType(ptype string) error {
+	if _, ok := mgr.enforcer.GetModel()[section(ptype)][ptype]; !ok {
+		return ErrUnknownPolicyType
+	}
+	return nil
+}
+
+// ValidateRule checks the ptype is defined by the model and the rule has
+// a non empty value for every field of it
+func (mgr *Manager) ValidateRule(ptype string, rule []string) error {
+	if err := mgr.ValidatePolicyType(ptype); err != nil {
+		return err
+	}
+	assertion := mgr.enforcer.GetModel()[section(ptype)][ptype]
+	if len(rule) != len(assertion.Tokens) {
+		return ErrInvalidRule
+	}
+	for _, field := range rule {
+		if len(strings.TrimSpace(field)) == 0 {
+			return ErrInvalidRule
+		}
+	}
+	return nil
+}
+
+// Rules return the rules of the ptype, field filters can be specified like GetFilteredPolicy
+func (mgr *Manager) Rules(ptype string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	if section(ptype) == "g" {
+		return mgr.enforcer.GetFilteredNamedGroupingPolicy(ptype, fieldIndex, fieldValues...)
+	}
+	return mgr.enforcer.GetFilteredNamedPolicy(ptype, fieldIndex, fieldValues...)
+}
+
+// HasRule determines whether the rule of the ptype exists
+func (mgr *Manager) HasRule(ptype string, rule []string) (bool, error) {
+	if section(ptype) == "g" {
+		return mgr.enforcer.HasNamedGroupingPolicy(ptype, rule)
+	}
+	return mgr.enforcer.HasNamedPolicy(ptype, rule)
+}
+
+// AddRule adds a rule of the ptype, added is false if the rule already exists
+func (mgr *Manager) AddRule(ptype string, rule []string) (added bool, err error) {
+	if section(ptype) == "g" {
+		return mgr.AddNamedGroupingPolicy(ptype, rule...)
+	}
+	return mgr.AddNamedPolicy(ptype, rule...)
+}
+
+// RemoveRule removes a rule of the ptype, removed is false if the rule does not exist
+func (mgr *Manager) RemoveRule(ptype string, rule []string) (removed bool, err error) {
+	if section(ptype) == "g" {
+		return mgr.RemoveNamedGroupingPolicy(ptype, rule...)
+	}
+	return mgr.RemoveNamedPolicy(ptype, rule...)
+}
+
+// UpdateRule replaces the rule of the ptype, updated is false if the old rule does not exist.
+// The rule is removed and added in two steps if the adapter can not update rules
+func (mgr *Manager) UpdateRule(ptype string, oldRule, newRule []string) (updated bool, err error) {
+	if _, ok := mgr.adapter.(persist.UpdatableAdapter); ok || !mgr.persists() {
+		if section(ptype) == "g" {
+			return mgr.notify(mgr.enforcer.UpdateNamedGroupingPolicy(ptype, oldRule, newRule))
+		}
+		return mgr.notify(mgr.enforcer.UpdateNamedPolicy(ptype, oldRule, newRule))
+	}
+
+	if updated, err = mgr.RemoveRule(ptype, oldRule); !updated || err != nil {
+		return updated, err
+	}
+	_, err = mgr.AddRule(ptype, newRule)
+	return true, err
+}
+
+// AddRules adds the rules of the ptype skipping the existing ones,
+// added is the number of the new rules. If the adapter is a persist.BatchAdapter
+// the new rules are added at once and none of them is kept on failure, otherwise
+// they are added one by one and the ones before the failure are kept
+func (mgr *Manager) AddRules(ptype string, rules [][]string) (added int, err error) {
+	var newRules [][]string
+	for _, rule := range rules {
+		has, err := mgr.HasRule(ptype, rule)
+		if err != nil {
+			return 0, err
+		}
+		if !has {
+			newRules = append(newRules, rule)
+		}
+	}
+	if len(newRules) == 0 {
+		return 0, nil
+	}
+
+	if _, ok := mgr.adapter.(persist.BatchAdapter); !ok && mgr.persists() {
+		for _, rule := range newRules {
+			ok, err := mgr.AddRule(ptype, rule)
+			if err != nil {
+				return added, err
+			}
+			if ok {
+				added++
+			}
+		}
+		return added, nil
+	}
+
+	var changed bool
+	if section(ptype) == "g" {
+		changed, err = mgr.enforcer.AddNamedGroupingPoliciesEx(ptype, newRules)
+	} else {
+		changed, err = mgr.enforcer.AddNamedPoliciesEx(ptype, newRules)
+	}
+	if _, err = mgr.notify(changed, err); err != nil || !changed {
+		return 0, err
+	}
+	return len(newRules), nil
+}
+
+// persists reports whether the changes are saved to the adapter at once
+func (mgr *Manager) persists() bool {
+	return mgr.adapter != nil && mgr.autoSave
+}
+
+// section return the section of the ptype in the model
+func section(ptype string) string {
+	if strings.HasPrefix(ptype, "g") {
+		return "g"
+	}
+	return "p"
+}
+
+// notify calls the hooks if the policy is changed
+func (mgr *Manager) notify(changed bool, err error) (bool, error) {
+	if !changed {
+		return changed, err
+	}
+	mgr.changed()
+	if err == nil && mgr.autoSave {
+		err = mgr.saved()
+	}
+	return changed, err
+}
+
+func (mgr *Manager) changed() {
+	if mgr.OnChange != nil {
+		mgr.OnChange()
+	}
+}
+
+func (mgr *Manager) saved() error {
+	if mgr.OnSave != nil {
+		return mgr.OnSave()
+	}
+	return nil
+}
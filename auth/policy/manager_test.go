@@ -0,0 +1,221 @@
+package policy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Myriad-Dreamin/gin-middleware/auth/privileger"
+	"github.com/casbin/casbin/v2/persist"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+)
+
+var (
+	_ privileger.ExplainingValidator = (*Manager)(nil)
+	_ privileger.BatchValidator      = (*Manager)(nil)
+	_ privileger.SubjectLister       = (*Manager)(nil)
+	_ persist.BatchAdapter           = (*txAdapter)(nil)
+)
+
+const testModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && keyMatch2(r.obj, p.obj) && r.act == p.act
+`
+
+func TestManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "policy.csv")
+	if err = ioutil.WriteFile(filename, []byte("p, admin, /api/users/:id, PUT\ng, user:1, admin\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mgr, err := NewManagerFromString(testModel, fileadapter.NewAdapter(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the file adapter does not save single rules
+	mgr.EnableAutoSave(false)
+	changes, saves := 0, 0
+	mgr.OnChange = func() { changes++ }
+	mgr.OnSave = func() error {
+		saves++
+		return nil
+	}
+
+	if allowed, err := mgr.Enforce("user:1", "/api/users/2", "PUT"); !allowed || err != nil {
+		t.Error("user:1 should be allowed", err)
+	}
+	if allowed, explain, err := mgr.EnforceEx("user:1", "/api/users/2", "PUT"); !allowed || len(explain) == 0 || err != nil {
+		t.Error("bad explanation", explain, err)
+	}
+
+	if added, err := mgr.AddPolicy("user:2", "/api/users/2", "GET"); !added || err != nil {
+		t.Fatal("policy not added", err)
+	}
+	if added, _ := mgr.AddPolicy("user:2", "/api/users/2", "GET"); added {
+		t.Error("duplicated policy added")
+	}
+	if results, err := mgr.BatchEnforce([][]interface{}{
+		{"user:2", "/api/users/2", "GET"},
+		{"user:2", "/api/users/2", "PUT"},
+	}); err != nil || !results[0] || results[1] {
+		t.Error("bad batch", results, err)
+	}
+	if removed, err := mgr.RemoveGroupingPolicy("user:1", "admin"); !removed || err != nil {
+		t.Fatal("grouping policy not removed", err)
+	}
+	if allowed, _ := mgr.Enforce("user:1", "/api/users/2", "PUT"); allowed {
+		t.Error("user:1 should be denied")
+	}
+	if err = mgr.SavePolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if changes != 2 || saves != 1 {
+		t.Error("bad hook calls", changes, saves)
+	}
+
+	other, err := NewManagerFromString(testModel, fileadapter.NewAdapter(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules, _ := other.GetPolicy(); len(rules) != 2 {
+		t.Error("policy not saved", rules)
+	}
+	if roles, _ := other.GetAllRoles(); len(roles) != 0 {
+		t.Error("grouping policy not saved", roles)
+	}
+}
+
+// TestManager_SampleModels enforces the example models of sample/user through casbin
+func TestManager_SampleModels(t *testing.T) {
+	// Wednesday 10:00 and 22:00
+	day, night := time.Date(2006, 1, 4, 10, 0, 0, 0, time.UTC), time.Date(2006, 1, 4, 22, 0, 0, 0, time.UTC)
+	attrs := func(owner bool, clientIP string, at time.Time) *privileger.Attributes {
+		return &privileger.Attributes{Subject: "user:1", Owner: owner, ClientIP: clientIP, Time: at}
+	}
+
+	for _, tc := range []struct {
+		model    string
+		snapshot Snapshot
+		requests [][]interface{}
+		allowed  []bool
+	}{
+		{"rbac.conf", Snapshot{
+			"p": {{"admin", "^/api/users/.*$", "^(GET|PUT)$"}},
+			"g": {{"user:1", "admin"}},
+		}, [][]interface{}{
+			{"user:1", "/api/users/42", "PUT"},
+			{"user:1", "/api/users/42", "DELETE"},
+			{"user:2", "/api/users/42", "GET"},
+		}, []bool{true, false, false}},
+		{"rbac_with_owner.conf", Snapshot{
+			"p": {{"user", "/api/users/:id", "GET", "any"}, {"user", "/api/users/:id", "PUT", "owner"}},
+			"g": {{"user:1", "user"}},
+		}, [][]interface{}{
+			{"user:1", "/api/users/42", "GET", attrs(false, "", day)},
+			{"user:1", "/api/users/1", "PUT", attrs(true, "", day)},
+			{"user:1", "/api/users/42", "PUT", attrs(false, "", day)},
+		}, []bool{true, true, false}},
+		{"rbac_with_domains.conf", Snapshot{
+			"p": {{"admin", "org:1", "/api/users/:id", "GET|PUT"}},
+			"g": {{"user:1", "admin", "org:1"}},
+		}, [][]interface{}{
+			{"user:1", "org:1", "/api/users/42", "PUT"},
+			{"user:1", "org:2", "/api/users/42", "PUT"},
+		}, []bool{true, false}},
+		{"rbac_with_conditions.conf", Snapshot{
+			"p": {{"admin", "/api/admin/*", "GET|PUT", "10.0.0.0/8", "09:00-18:00 Mon-Fri"}},
+			"g": {{"user:1", "admin"}},
+		}, [][]interface{}{
+			{"user:1", "/api/admin/users", "PUT", attrs(false, "10.1.2.3", day)},
+			{"user:1", "/api/admin/users", "PUT", attrs(false, "203.0.113.7", day)},
+			{"user:1", "/api/admin/users", "PUT", attrs(false, "10.1.2.3", night)},
+		}, []bool{true, false, false}},
+	} {
+		mgr, err := NewManagerFromFile(filepath.Join("..", "..", "sample", "user", tc.model), nil)
+		if err != nil {
+			t.Fatal(tc.model, err)
+		}
+		if _, err = mgr.Apply(tc.snapshot); err != nil {
+			t.Fatal(tc.model, err)
+		}
+		for i, request := range tc.requests {
+			if allowed, err := mgr.Enforce(request...); err != nil || allowed != tc.allowed[i] {
+				t.Error("bad decision", tc.model, request, allowed, err)
+			}
+		}
+		if issues, err := mgr.Lint(); err != nil || HasErrors(issues) {
+			t.Error("bad lint", tc.model, issues, err)
+		}
+	}
+}
+
+// txAdapter adds the batches in a transaction like a table, the batch fails
+// at the rule failAt and is rolled back
+type txAdapter struct {
+	failingAdapter
+	rules  [][]string
+	failAt int
+}
+
+func (a *txAdapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	tx := append([][]string{}, a.rules...)
+	for i, rule := range rules {
+		if i == a.failAt {
+			return errors.New("duplicate entry")
+		}
+		tx = append(tx, append([]string{ptype}, rule...))
+	}
+	a.rules = tx
+	return nil
+}
+
+func (a *txAdapter) RemovePolicies(string, string, [][]string) error {
+	return nil
+}
+
+func TestManager_AddRulesRollback(t *testing.T) {
+	adapter := &txAdapter{failAt: 1}
+	mgr, err := NewManagerFromString(testModel, adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := [][]string{{"user:1", "/a", "GET"}, {"user:1", "/b", "GET"}, {"user:1", "/c", "GET"}}
+
+	if added, err := mgr.AddRules("p", rules); err == nil || added != 0 {
+		t.Fatal("failed batch not reported", added, err)
+	}
+	if len(adapter.rules) != 0 {
+		t.Error("partial batch left in the adapter", adapter.rules)
+	}
+	if has, _ := mgr.HasPolicy(rules[0]...); has {
+		t.Error("partial batch left in memory")
+	}
+
+	adapter.failAt = -1
+	if added, err := mgr.AddRules("p", rules); err != nil || added != 3 || len(adapter.rules) != 3 {
+		t.Fatal("batch not added", added, err, adapter.rules)
+	}
+	if allowed, _ := mgr.Enforce("user:1", "/c", "GET"); !allowed {
+		t.Error("batch not enforced")
+	}
+}
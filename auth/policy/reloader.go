@@ -0,0 +1,179 @@
+package policy
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Myriad-Dreamin/gin-middleware/auth/privileger"
+)
+
+// Loader builds a validator from the current policy source, e.g.
+//
+//	func() (privileger.Validator, error) {
+//		return casbin.NewEnforcer("rbac.conf", adapter)
+//	}
+type Loader func() (privileger.Validator, error)
+
+// Reloader is a privileger.Validator delegating to the latest loaded validator,
+// the validator is swapped atomically so the requests in flight are never blocked
+type Reloader struct {
+	load    Loader
+	current atomic.Value
+
+	// mutex serialises the reloads
+	mutex   sync.Mutex
+	version string
+	synced  bool
+
+	// Version detects the changes of the policy source, e.g. FileVersion for the
+	// file adapters and SQLVersion for the database adapters, Sync reloads on
+	// every call if it is nil
+	Version VersionFunc
+
+	// OnReload is called after the validator is swapped, e.g.
+	// privileger.MiddleWare.Invalidate to drop the cached decisions
+	OnReload func()
+
+	// OnError receives the failures of the reloads in Watch, the old validator is kept
+	OnError func(err error)
+}
+
+// validatorHolder keeps the concrete type stored in atomic.Value consistent
+type validatorHolder struct {
+	v privileger.Validator
+}
+
+// NewReloader return the reloader with the validator loaded once
+func NewReloader(load Loader) (*Reloader, error) {
+	reloader := &Reloader{load: load}
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Validator return the validator currently in use
+func (reloader *Reloader) Validator() privileger.Validator {
+	return reloader.current.Load().(validatorHolder).v
+}
+
+// Reload loads the policy and swaps the validator
+func (reloader *Reloader) Reload() error {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+	return reloader.reload()
+}
+
+// Sync reloads the policy if its version changed since the last load
+func (reloader *Reloader) Sync() (reloaded bool, err error) {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	if reloader.Version == nil {
+		return true, reloader.reload()
+	}
+	version, err := reloader.Version()
+	if err != nil {
+		return false, err
+	}
+	if reloader.synced && version == reloader.version {
+		return false, nil
+	}
+	if err = reloader.reload(); err != nil {
+		return false, err
+	}
+	reloader.version, reloader.synced = version, true
+	return true, nil
+}
+
+// Watch calls Sync every interval until stop is called, e.g.
+//
+//	stop := reloader.Watch(10 * time.Second)
+//	defer stop()
+func (reloader *Reloader) Watch(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := reloader.Sync(); err != nil && reloader.OnError != nil {
+					reloader.OnError(err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
+
+func (reloader *Reloader) reload() error {
+	v, err := reloader.load()
+	if err != nil {
+		return err
+	}
+	reloader.current.Store(validatorHolder{v: v})
+	if reloader.OnReload != nil {
+		reloader.OnReload()
+	}
+	return nil
+}
+
+// Enforce implements privileger.Validator
+func (reloader *Reloader) Enforce(rvals ...interface{}) (bool, error) {
+	return reloader.Validator().Enforce(rvals...)
+}
+
+// EnforceEx implements privileger.ExplainingValidator, the explanation is empty
+// if the current validator does not explain
+func (reloader *Reloader) EnforceEx(rvals ...interface{}) (bool, []string, error) {
+	v := reloader.Validator()
+	if explaining, ok := v.(privileger.ExplainingValidator); ok {
+		return explaining.EnforceEx(rvals...)
+	}
+	allowed, err := v.Enforce(rvals...)
+	return allowed, nil, err
+}
+
+// BatchEnforce implements privileger.BatchValidator, the requests are evaluated
+// one by one if the current validator does not batch
+func (reloader *Reloader) BatchEnforce(requests [][]interface{}) ([]bool, error) {
+	v := reloader.Validator()
+	if batch, ok := v.(privileger.BatchValidator); ok {
+		return batch.BatchEnforce(requests)
+	}
+	results := make([]bool, len(requests))
+	for i, rvals := range requests {
+		allowed, err := v.Enforce(rvals...)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = allowed
+	}
+	return results, nil
+}
+
+// GetAllSubjects implements privileger.SubjectLister
+func (reloader *Reloader) GetAllSubjects() ([]string, error) {
+	if lister, ok := reloader.Validator().(privileger.SubjectLister); ok {
+		return lister.GetAllSubjects()
+	}
+	return nil, nil
+}
+
+// GetAllRoles implements privileger.SubjectLister
+func (reloader *Reloader) GetAllRoles() ([]string, error) {
+	if lister, ok := reloader.Validator().(privileger.SubjectLister); ok {
+		return lister.GetAllRoles()
+	}
+	return nil, nil
+}
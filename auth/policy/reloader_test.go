@@ -0,0 +1,103 @@
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Myriad-Dreamin/gin-middleware/auth/privileger"
+)
+
+func writePolicy(t *testing.T, filename, policy string, modTime time.Time) {
+	if err := ioutil.WriteFile(filename, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filename, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloader_Sync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "policy.yaml")
+	now := time.Now()
+	writePolicy(t, filename, `
+rules:
+  - {subject: user:1, object: /a, actions: [GET]}
+`, now.Add(-time.Minute))
+
+	loads := 0
+	reloader, err := NewReloader(func() (privileger.Validator, error) {
+		loads++
+		return privileger.LoadMemoryValidator(filename)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloads := 0
+	reloader.OnReload = func() { reloads++ }
+	reloader.Version = FileVersion(filename)
+
+	if reloaded, err := reloader.Sync(); !reloaded || err != nil {
+		t.Fatal("first sync should load the version", reloaded, err)
+	}
+	if reloaded, err := reloader.Sync(); reloaded || err != nil {
+		t.Fatal("unchanged policy reloaded", reloaded, err)
+	}
+	if allowed, _ := reloader.Enforce("user:1", "/a", "GET"); !allowed {
+		t.Error("user:1 should be allowed")
+	}
+
+	writePolicy(t, filename, `
+rules:
+  - {subject: user:2, object: /a, actions: [GET]}
+`, now)
+	if reloaded, err := reloader.Sync(); !reloaded || err != nil {
+		t.Fatal("changed policy not reloaded", reloaded, err)
+	}
+	if allowed, _ := reloader.Enforce("user:1", "/a", "GET"); allowed {
+		t.Error("user:1 should be denied after reload")
+	}
+	if allowed, _, _ := reloader.EnforceEx("user:2", "/a", "GET"); !allowed {
+		t.Error("user:2 should be allowed after reload")
+	}
+	if loads != 3 || reloads != 2 {
+		t.Error("bad reload count", loads, reloads)
+	}
+
+	// a broken policy keeps the old validator
+	writePolicy(t, filename, "rules: [", now.Add(time.Minute))
+	if _, err := reloader.Sync(); err == nil {
+		t.Error("broken policy loaded")
+	}
+	if allowed, _ := reloader.Enforce("user:2", "/a", "GET"); !allowed {
+		t.Error("old validator should be kept")
+	}
+}
+
+func TestReloader_Watch(t *testing.T) {
+	reloaded := make(chan struct{}, 16)
+	reloader, err := NewReloader(func() (privileger.Validator, error) {
+		return privileger.Static(true), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader.OnReload = func() { reloaded <- struct{}{} }
+
+	stop := reloader.Watch(time.Millisecond)
+	defer stop()
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("policy was not reloaded")
+	}
+	stop()
+}
@@ -0,0 +1,419 @@
+package policy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Myriad-Dreamin/gin-middleware/auth/jwt"
+	"github.com/Myriad-Dreamin/gin-middleware/auth/privileger"
+	"github.com/gin-gonic/gin"
+)
+
+// The permissions required by the policy administration routes
+const (
+	PolicyObject = "policy"
+	ReadAction   = "read"
+	WriteAction  = "write"
+)
+
+// DefaultPageSize and MaxPageSize bound the page_size of the rule listing
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 1000
+)
+
+// RuleRequest is the body adding or removing a rule, PType is "p" if empty
+type RuleRequest struct {
+	PType string   `json:"ptype"`
+	Rule  []string `json:"rule" binding:"required"`
+}
+
+// UpdateRuleRequest is the body replacing the Old rule by the New one
+type UpdateRuleRequest struct {
+	PType string   `json:"ptype"`
+	Old   []string `json:"old" binding:"required"`
+	New   []string `json:"new" binding:"required"`
+}
+
+// ImportRequest is the body adding many rules at once
+type ImportRequest struct {
+	PType string     `json:"ptype"`
+	Rules [][]string `json:"rules" binding:"required"`
+}
+
+// RulesResponse is a page of the rules
+type RulesResponse struct {
+	PType    string     `json:"ptype"`
+	Total    int        `json:"total"`
+	Page     int        `json:"page"`
+	PageSize int        `json:"page_size"`
+	Rules    [][]string `json:"rules"`
+}
+
+// RegisterPolicyRoutes mounts the policy administration API on the group, every
+// route requires the PolicyObject permission through authmw.Require, so the group
+// should not enforce on the request path again, e.g.
+//
+//	policy.RegisterPolicyRoutes(r.Group("/admin", jwtmw.Build()), mgr, authmw)
+//
+// The routes are
+//
+//	GET    /rules?ptype=p&v0=alice&page=1&page_size=50  list the rules, v0-v5 filter the fields
+//	POST   /rules                                       add a rule, 201 or 409 if it exists
+//	PUT    /rules                                       update a rule, 404 if the old one is missing
+//	DELETE /rules                                       remove a rule, 204 or 404 if it is missing
+//	POST   /rules/import                                add the rules skipping the existing ones
+//	GET    /roles/:role/members                         list the users of the role
+//	PUT    /roles/:role/members/:member                 add the member to the role, 204
+//	DELETE /roles/:role/members/:member                 remove the member from the role, 204 or 404
+//	GET    /subjects/:subject/roles                     list the roles of the subject
+//
+// and if mgr.Audit is set, the mutations above are recorded with the subject as actor
+//
+//	GET    /audit?page=1&page_size=50                   list the audit records, the newest first
+//	POST   /audit/:id/rollback                          apply the policy before the record
+func RegisterPolicyRoutes(group *gin.RouterGroup, mgr *Manager, authmw *privileger.MiddleWare) gin.IRoutes {
+	read := authmw.Require(PolicyObject, ReadAction)
+	write := authmw.Require(PolicyObject, WriteAction)
+	api := &policyAPI{mgr: mgr, actor: authmw.SubjectResolver}
+
+	group.GET("/rules", read, api.listRules)
+	group.POST("/rules", write, api.addRule)
+	group.PUT("/rules", write, api.updateRule)
+	group.DELETE("/rules", write, api.removeRule)
+	group.POST("/rules/import", write, api.importRules)
+	group.GET("/roles/:role/members", read, api.listMembers)
+	group.PUT("/roles/:role/members/:member", write, api.addMember)
+	group.DELETE("/roles/:role/members/:member", write, api.removeMember)
+	group.GET("/subjects/:subject/roles", read, api.listRoles)
+	if mgr.Audit != nil {
+		group.GET("/audit", read, api.listRecords)
+		group.POST("/audit/:id/rollback", write, api.rollback)
+	}
+	return group
+}
+
+type policyAPI struct {
+	mgr   *Manager
+	actor privileger.SubjectResolver
+}
+
+func (api *policyAPI) listRules(c *gin.Context) {
+	ptype := c.DefaultQuery("ptype", "p")
+	page, pageSize, err := pagination(c)
+	if err == nil {
+		err = api.mgr.ValidatePolicyType(ptype)
+	}
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	fieldIndex, fieldValues := fieldFilter(c)
+	rules, err := api.mgr.Rules(ptype, fieldIndex, fieldValues...)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := RulesResponse{PType: ptype, Total: len(rules), Page: page, PageSize: pageSize, Rules: [][]string{}}
+	if start := (page - 1) * pageSize; start < len(rules) {
+		end := start + pageSize
+		if end > len(rules) {
+			end = len(rules)
+		}
+		resp.Rules = rules[start:end]
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (api *policyAPI) addRule(c *gin.Context) {
+	var req RuleRequest
+	if !api.bindRule(c, &req) {
+		return
+	}
+	added, err := api.audited(c, describe("add", req.PType, req.Rule), func() (bool, error) {
+		return api.mgr.AddRule(req.PType, req.Rule)
+	})
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+	} else if !added {
+		abortWithError(c, http.StatusConflict, ErrRuleExists)
+	} else {
+		c.JSON(http.StatusCreated, req)
+	}
+}
+
+func (api *policyAPI) updateRule(c *gin.Context) {
+	var req UpdateRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.PType) == 0 {
+		req.PType = "p"
+	}
+	if err := api.mgr.ValidateRule(req.PType, req.New); err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if has, err := api.mgr.HasRule(req.PType, req.New); err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	} else if has {
+		abortWithError(c, http.StatusConflict, ErrRuleExists)
+		return
+	}
+	updated, err := api.audited(c, describe("update", req.PType, req.Old), func() (bool, error) {
+		return api.mgr.UpdateRule(req.PType, req.Old, req.New)
+	})
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+	} else if !updated {
+		abortWithError(c, http.StatusNotFound, ErrRuleNotFound)
+	} else {
+		c.JSON(http.StatusOK, RuleRequest{PType: req.PType, Rule: req.New})
+	}
+}
+
+func (api *policyAPI) removeRule(c *gin.Context) {
+	var req RuleRequest
+	if !api.bindRule(c, &req) {
+		return
+	}
+	removed, err := api.audited(c, describe("remove", req.PType, req.Rule), func() (bool, error) {
+		return api.mgr.RemoveRule(req.PType, req.Rule)
+	})
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+	} else if !removed {
+		abortWithError(c, http.StatusNotFound, ErrRuleNotFound)
+	} else {
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (api *policyAPI) importRules(c *gin.Context) {
+	var req ImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.PType) == 0 {
+		req.PType = "p"
+	}
+	for _, rule := range req.Rules {
+		if err := api.mgr.ValidateRule(req.PType, rule); err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	var added int
+	_, err := api.audited(c, fmt.Sprintf("import %d rules of %s", len(req.Rules), req.PType), func() (bool, error) {
+		var err error
+		added, err = api.mgr.AddRules(req.PType, req.Rules)
+		return added != 0, err
+	})
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ptype": req.PType,
+		"added": added,
+	})
+}
+
+func (api *policyAPI) listMembers(c *gin.Context) {
+	ptype := c.DefaultQuery("ptype", "g")
+	if err := api.mgr.ValidatePolicyType(ptype); err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	rules, err := api.mgr.Rules(ptype, 1, c.Param("role"))
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	members := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		members = append(members, rule[0])
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"role":    c.Param("role"),
+		"members": members,
+	})
+}
+
+func (api *policyAPI) addMember(c *gin.Context) {
+	ptype, rule := c.DefaultQuery("ptype", "g"), []string{c.Param("member"), c.Param("role")}
+	if err := api.mgr.ValidateRule(ptype, rule); err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	// adding an existing member is not an error as PUT is idempotent
+	if _, err := api.audited(c, describe("add", ptype, rule), func() (bool, error) {
+		return api.mgr.AddRule(ptype, rule)
+	}); err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (api *policyAPI) removeMember(c *gin.Context) {
+	ptype, rule := c.DefaultQuery("ptype", "g"), []string{c.Param("member"), c.Param("role")}
+	if err := api.mgr.ValidateRule(ptype, rule); err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	removed, err := api.audited(c, describe("remove", ptype, rule), func() (bool, error) {
+		return api.mgr.RemoveRule(ptype, rule)
+	})
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+	} else if !removed {
+		abortWithError(c, http.StatusNotFound, ErrRuleNotFound)
+	} else {
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (api *policyAPI) listRoles(c *gin.Context) {
+	ptype := c.DefaultQuery("ptype", "g")
+	if err := api.mgr.ValidatePolicyType(ptype); err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	rules, err := api.mgr.Rules(ptype, 0, c.Param("subject"))
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	roles := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		roles = append(roles, rule[1])
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"subject": c.Param("subject"),
+		"roles":   roles,
+	})
+}
+
+func (api *policyAPI) listRecords(c *gin.Context) {
+	page, pageSize, err := pagination(c)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	records, total, err := api.mgr.Audit.ListRecords((page-1)*pageSize, pageSize)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if records == nil {
+		records = []*AuditRecord{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+		"records":   records,
+	})
+}
+
+func (api *policyAPI) rollback(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	actor, _ := api.actor(c)
+	diff, err := api.mgr.Rollback(actor, id)
+	if err == ErrRecordNotFound {
+		abortWithError(c, http.StatusNotFound, err)
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+	} else {
+		c.JSON(http.StatusOK, diff)
+	}
+}
+
+// audited runs the mutation on behalf of the subject of the request
+func (api *policyAPI) audited(c *gin.Context, action string, mutation func() (bool, error)) (bool, error) {
+	actor, _ := api.actor(c)
+	return api.mgr.Audited(actor, action, mutation)
+}
+
+// describe return the action of the audit record, e.g. "add p, alice, /data, read"
+func describe(verb, ptype string, rule []string) string {
+	return verb + " " + strings.Join(append([]string{ptype}, rule...), ", ")
+}
+
+// bindRule binds the body and validates the rule, it responds 400 and return false on failure
+func (api *policyAPI) bindRule(c *gin.Context, req *RuleRequest) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return false
+	}
+	if len(req.PType) == 0 {
+		req.PType = "p"
+	}
+	if err := api.mgr.ValidateRule(req.PType, req.Rule); err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+// maxInt is math.MaxInt, which is missing before go 1.17
+const maxInt = int(^uint(0) >> 1)
+
+// pagination return the page and the page size of the query, the page starts from 1
+// and the offset of the page (page-1)*pageSize never overflows
+func pagination(c *gin.Context) (page, pageSize int, err error) {
+	if page, err = strconv.Atoi(c.DefaultQuery("page", "1")); err != nil || page < 1 {
+		return 0, 0, ErrInvalidPage
+	}
+	pageSize, err = strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(DefaultPageSize)))
+	if err != nil || pageSize < 1 || pageSize > MaxPageSize || page-1 > maxInt/pageSize {
+		return 0, 0, ErrInvalidPage
+	}
+	return page, pageSize, nil
+}
+
+// fieldFilter return the field filter of the query v0-v5, the missing fields
+// between the given ones match any value
+func fieldFilter(c *gin.Context) (fieldIndex int, fieldValues []string) {
+	first, last := -1, -1
+	values := make([]string, 6)
+	for i := range values {
+		values[i] = c.Query("v" + strconv.Itoa(i))
+		if len(values[i]) != 0 {
+			if first == -1 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first == -1 {
+		return 0, nil
+	}
+	return first, values[first : last+1]
+}
+
+func abortWithError(c *gin.Context, status int, err error) {
+	msg := err.Error()
+	if status == http.StatusInternalServerError {
+		_ = c.Error(err)
+		msg = http.StatusText(status)
+	}
+	c.AbortWithStatusJSON(status, jwt.UnauthorizedMessage{
+		Code: -1,
+		Msg:  msg,
+	})
+}
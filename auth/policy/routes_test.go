@@ -0,0 +1,167 @@
+package policy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Myriad-Dreamin/gin-middleware/auth/privileger"
+	"github.com/gin-gonic/gin"
+)
+
+func newPolicyRouter(t *testing.T, audit AuditStore) (*gin.Engine, *Manager) {
+	mgr, err := NewManagerFromString(testModel, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range [][]string{
+		{"admin", PolicyObject, ReadAction},
+		{"admin", PolicyObject, WriteAction},
+		{"auditor", PolicyObject, ReadAction},
+	} {
+		if _, err = mgr.AddPolicy(rule...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = mgr.AddGroupingPolicy("user:1", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = mgr.AddGroupingPolicy("user:2", "auditor"); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr.Audit = audit
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("uid", c.GetHeader("X-Uid"))
+	})
+	RegisterPolicyRoutes(r.Group("/admin"), mgr, privileger.NewMiddleWare(mgr, "user:", "uid"))
+	return r, mgr
+}
+
+func request(r *gin.Engine, uid, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Uid", uid)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRegisterPolicyRoutes(t *testing.T) {
+	r, mgr := newPolicyRouter(t, nil)
+
+	for i, tc := range []struct {
+		uid, method, path, body string
+		status                  int
+	}{
+		{"2", "GET", "/admin/rules", "", http.StatusOK},
+		{"2", "POST", "/admin/rules", `{"rule":["user:3","/a","GET"]}`, http.StatusForbidden},
+		{"1", "POST", "/admin/rules", `{"rule":["user:3","/a","GET"]}`, http.StatusCreated},
+		{"1", "POST", "/admin/rules", `{"rule":["user:3","/a","GET"]}`, http.StatusConflict},
+		{"1", "POST", "/admin/rules", `{"rule":["user:3","/a"]}`, http.StatusBadRequest},
+		{"1", "POST", "/admin/rules", `{"ptype":"p9","rule":["user:3","/a","GET"]}`, http.StatusBadRequest},
+		{"1", "POST", "/admin/rules", `{}`, http.StatusBadRequest},
+		{"1", "PUT", "/admin/rules", `{"old":["user:3","/a","GET"],"new":["user:3","/a","PUT"]}`, http.StatusOK},
+		{"1", "PUT", "/admin/rules", `{"old":["user:3","/a","GET"],"new":["user:3","/b","PUT"]}`, http.StatusNotFound},
+		{"1", "DELETE", "/admin/rules", `{"rule":["user:3","/a","PUT"]}`, http.StatusNoContent},
+		{"1", "DELETE", "/admin/rules", `{"rule":["user:3","/a","PUT"]}`, http.StatusNotFound},
+		{"1", "POST", "/admin/rules/import", `{"rules":[["user:3","/a","GET"],["user:3","/b","GET"],["admin","policy","read"]]}`, http.StatusOK},
+		{"1", "GET", "/admin/rules?page=0", "", http.StatusBadRequest},
+		{"1", "GET", "/admin/rules?page=9223372036854775807&page_size=1000", "", http.StatusBadRequest},
+		{"1", "GET", "/admin/rules?page=9223372&page_size=1000", "", http.StatusOK},
+		{"1", "PUT", "/admin/roles/auditor/members/user:3", "", http.StatusNoContent},
+		{"1", "PUT", "/admin/roles/auditor/members/user:3", "", http.StatusNoContent},
+		{"1", "DELETE", "/admin/roles/auditor/members/user:4", "", http.StatusNotFound},
+		{"", "GET", "/admin/rules", "", http.StatusUnauthorized},
+	} {
+		if w := request(r, tc.uid, tc.method, tc.path, tc.body); w.Code != tc.status {
+			t.Error("bad status", i, tc.method, tc.path, w.Code, w.Body.String())
+		}
+	}
+
+	if has, _ := mgr.HasPolicy("user:3", "/b", "GET"); !has {
+		t.Error("rules not imported")
+	}
+
+	var resp RulesResponse
+	w := request(r, "2", "GET", "/admin/rules?v0=user:3&page_size=1&page=2", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 2 || len(resp.Rules) != 1 || resp.Rules[0][0] != "user:3" {
+		t.Error("bad page", w.Body.String())
+	}
+
+	w = request(r, "2", "GET", "/admin/roles/auditor/members", "")
+	if w.Code != http.StatusOK || w.Body.String() != `{"members":["user:2","user:3"],"role":"auditor"}` {
+		t.Error("bad members", w.Body.String())
+	}
+	w = request(r, "2", "GET", "/admin/subjects/user:3/roles", "")
+	if w.Code != http.StatusOK || w.Body.String() != `{"roles":["auditor"],"subject":"user:3"}` {
+		t.Error("bad roles", w.Body.String())
+	}
+}
+
+func TestRegisterPolicyRoutes_Audit(t *testing.T) {
+	r, mgr := newPolicyRouter(t, NewMemoryAuditStore())
+
+	if w := request(r, "1", "POST", "/admin/rules", `{"rule":["user:3","/a","GET"]}`); w.Code != http.StatusCreated {
+		t.Fatal("bad status", w.Code)
+	}
+	if w := request(r, "1", "POST", "/admin/rules", `{"rule":["user:3","/a","GET"]}`); w.Code != http.StatusConflict {
+		t.Fatal("bad status", w.Code)
+	}
+	if w := request(r, "1", "PUT", "/admin/roles/admin/members/user:3", ""); w.Code != http.StatusNoContent {
+		t.Fatal("bad status", w.Code)
+	}
+
+	var resp struct {
+		Total   int64          `json:"total"`
+		Records []*AuditRecord `json:"records"`
+	}
+	w := request(r, "2", "GET", "/admin/audit", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 2 || resp.Records[0].Action != "add g, user:3, admin" || resp.Records[1].Actor != "user:1" {
+		t.Fatal("bad records", w.Body.String())
+	}
+	if diff := resp.Records[1].Diff(); len(diff.Added["p"]) != 1 || len(diff.Removed) != 0 {
+		t.Error("bad record diff", diff)
+	}
+	if w = request(r, "2", "GET", "/admin/audit?page=9223372036854775807&page_size=1000", ""); w.Code != http.StatusBadRequest {
+		t.Error("bad status", w.Code)
+	}
+	if w = request(r, "2", "GET", "/admin/audit?page=9223372&page_size=1000", ""); w.Code != http.StatusOK ||
+		!strings.Contains(w.Body.String(), `"records":[]`) {
+		t.Error("bad last page", w.Code, w.Body.String())
+	}
+	if records, _, _ := mgr.Audit.ListRecords(-1000, 1); len(records) != 1 || records[0].ID != 2 {
+		t.Error("negative offset not clamped", records)
+	}
+
+	if w = request(r, "2", "POST", "/admin/audit/1/rollback", ""); w.Code != http.StatusForbidden {
+		t.Error("auditor rolled back", w.Code)
+	}
+	if w = request(r, "1", "POST", "/admin/audit/9/rollback", ""); w.Code != http.StatusNotFound {
+		t.Error("bad status", w.Code)
+	}
+	if w = request(r, "1", "POST", "/admin/audit/1/rollback", ""); w.Code != http.StatusOK {
+		t.Fatal("bad status", w.Code, w.Body.String())
+	}
+	if has, _ := mgr.HasPolicy("user:3", "/a", "GET"); has {
+		t.Error("rule not rolled back")
+	}
+	if has, _ := mgr.HasGroupingPolicy("user:3", "admin"); has {
+		t.Error("later rule not rolled back")
+	}
+
+	records, total, _ := mgr.Audit.ListRecords(0, 1)
+	if total != 3 || records[0].Actor != "user:1" || records[0].Action != "rollback to 1" {
+		t.Error("rollback not audited", total, records[0])
+	}
+}
@@ -0,0 +1,291 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/casbin/casbin/v2"
+)
+
+// Snapshot is the rules of every ptype, e.g.
+//
+//	{"p": [["admin", "/api/users/*", "GET"]], "g": [["user:1", "admin"]]}
+type Snapshot map[string][][]string
+
+// Diff is the change from a snapshot to another
+type Diff struct {
+	Added   Snapshot `json:"added"`
+	Removed Snapshot `json:"removed"`
+}
+
+// Export return the snapshot of the rules of every ptype defined by the model
+func (mgr *Manager) Export() (Snapshot, error) {
+	snapshot := make(Snapshot)
+	for _, ptype := range mgr.policyTypes() {
+		rules, err := mgr.Rules(ptype, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(rules) != 0 {
+			snapshot[ptype] = rules
+		}
+	}
+	return snapshot, nil
+}
+
+// Diff return the change from the current policy to the snapshot
+func (mgr *Manager) Diff(snapshot Snapshot) (*Diff, error) {
+	current, err := mgr.Export()
+	if err != nil {
+		return nil, err
+	}
+	return DiffSnapshots(current, snapshot), nil
+}
+
+// Apply replaces the whole policy by the snapshot and saves it to the adapter.
+// The snapshot is validated first, the enforcer is locked during the replacement
+// and the old policy is restored if the adapter fails, so the requests never
+// see a partial policy in memory. The old policy is saved back to the adapter
+// too, but the storage is only atomic if SavePolicy of the adapter is, e.g.
+// one saving in a database transaction
+func (mgr *Manager) Apply(snapshot Snapshot) (*Diff, error) {
+	for ptype, rules := range snapshot {
+		for _, rule := range rules {
+			if err := mgr.ValidateRule(ptype, rule); err != nil {
+				return nil, fmt.Errorf("%v: %s, %s", err, ptype, strings.Join(rule, ", "))
+			}
+		}
+	}
+
+	diff, err := mgr.replace(snapshot)
+	if err != nil || diff.Empty() {
+		return diff, err
+	}
+	mgr.changed()
+	if mgr.adapter != nil {
+		err = mgr.saved()
+	}
+	return diff, err
+}
+
+func (mgr *Manager) replace(snapshot Snapshot) (*Diff, error) {
+	lock := mgr.enforcer.GetLock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	// the embedded enforcer is used since the lock is held
+	enforcer := mgr.enforcer.Enforcer
+	current := make(Snapshot)
+	for _, ptype := range mgr.policyTypes() {
+		rules, err := enforcer.GetModel().GetPolicy(section(ptype), ptype)
+		if err != nil {
+			return nil, err
+		}
+		if len(rules) != 0 {
+			current[ptype] = rules
+		}
+	}
+	diff := DiffSnapshots(current, snapshot)
+	if diff.Empty() {
+		return diff, nil
+	}
+
+	err := loadSnapshot(enforcer, snapshot)
+	if err == nil && mgr.adapter != nil {
+		err = enforcer.SavePolicy()
+	}
+	if err != nil {
+		restoreErr := loadSnapshot(enforcer, current)
+		if restoreErr == nil && mgr.adapter != nil {
+			// the adapter may have saved a part of the snapshot
+			restoreErr = enforcer.SavePolicy()
+		}
+		if restoreErr != nil {
+			return nil, fmt.Errorf("%v, restore failed: %v", err, restoreErr)
+		}
+		return nil, err
+	}
+	return diff, nil
+}
+
+// loadSnapshot replaces the policy in memory of the enforcer by the snapshot
+func loadSnapshot(enforcer *casbin.Enforcer, snapshot Snapshot) error {
+	enforcer.ClearPolicy()
+	m := enforcer.GetModel()
+	for ptype, rules := range snapshot {
+		if err := m.AddPolicies(section(ptype), ptype, rules); err != nil {
+			return err
+		}
+	}
+	return enforcer.BuildRoleLinks()
+}
+
+// policyTypes return the ptypes defined by the model, the policy rules go first
+func (mgr *Manager) policyTypes() []string {
+	m := mgr.enforcer.GetModel()
+	var ptypes []string
+	for _, sec := range []string{"p", "g"} {
+		start := len(ptypes)
+		for ptype := range m[sec] {
+			ptypes = append(ptypes, ptype)
+		}
+		sort.Strings(ptypes[start:])
+	}
+	return ptypes
+}
+
+// DiffSnapshots return the change from the snapshot to the target
+func DiffSnapshots(snapshot, target Snapshot) *Diff {
+	return &Diff{
+		Added:   subtractSnapshot(target, snapshot),
+		Removed: subtractSnapshot(snapshot, target),
+	}
+}
+
+// subtractSnapshot return the rules in s but not in t
+func subtractSnapshot(s, t Snapshot) Snapshot {
+	diff := make(Snapshot)
+	for ptype, rules := range s {
+		existing := make(map[string]bool, len(t[ptype]))
+		for _, rule := range t[ptype] {
+			existing[strings.Join(rule, "\x00")] = true
+		}
+		for _, rule := range rules {
+			if !existing[strings.Join(rule, "\x00")] {
+				diff[ptype] = append(diff[ptype], rule)
+			}
+		}
+	}
+	return diff
+}
+
+// Empty reports whether there is no change
+func (diff *Diff) Empty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0
+}
+
+// String return the change as the lines of CSV prefixed by "+ " or "- "
+func (diff *Diff) String() string {
+	var b bytes.Buffer
+	for _, line := range csvLines(diff.Removed) {
+		b.WriteString("- " + line + "\n")
+	}
+	for _, line := range csvLines(diff.Added) {
+		b.WriteString("+ " + line + "\n")
+	}
+	return b.String()
+}
+
+// WriteCSV writes the snapshot in the CSV of casbin file adapter, e.g.
+//
+//	p, admin, /api/users/*, GET
+//	g, user:1, admin
+//
+// the rules are sorted so that the output is stable under version control
+func WriteCSV(w io.Writer, snapshot Snapshot) error {
+	for _, line := range csvLines(snapshot) {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadCSV reads the snapshot in the CSV of casbin file adapter,
+// the empty lines and the lines starting with # are skipped
+func ReadCSV(r io.Reader) (Snapshot, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	snapshot := make(Snapshot)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return snapshot, nil
+		} else if err != nil {
+			return nil, err
+		}
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		if len(record) < 2 {
+			return nil, ErrInvalidRule
+		}
+		snapshot[record[0]] = append(snapshot[record[0]], record[1:])
+	}
+}
+
+// WriteJSON writes the snapshot as an indented JSON object keyed by the ptypes
+func WriteJSON(w io.Writer, snapshot Snapshot) error {
+	sorted := make(Snapshot, len(snapshot))
+	for ptype, rules := range snapshot {
+		sorted[ptype] = sortedRules(rules)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sorted)
+}
+
+// ReadJSON reads the snapshot written by WriteJSON
+func ReadJSON(r io.Reader) (Snapshot, error) {
+	var snapshot Snapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// csvLines return the sorted lines of the snapshot, the policy rules go first
+func csvLines(snapshot Snapshot) []string {
+	var lines []string
+	for _, ptype := range snapshotTypes(snapshot) {
+		for _, rule := range sortedRules(snapshot[ptype]) {
+			fields := make([]string, 0, len(rule)+1)
+			fields = append(fields, ptype)
+			for _, field := range rule {
+				fields = append(fields, csvField(field))
+			}
+			lines = append(lines, strings.Join(fields, ", "))
+		}
+	}
+	return lines
+}
+
+// snapshotTypes return the sorted ptypes of the snapshot, the policy rules go first
+func snapshotTypes(snapshot Snapshot) []string {
+	ptypes := make([]string, 0, len(snapshot))
+	for ptype := range snapshot {
+		ptypes = append(ptypes, ptype)
+	}
+	sort.Slice(ptypes, func(i, j int) bool {
+		if si, sj := section(ptypes[i]), section(ptypes[j]); si != sj {
+			return si == "p"
+		}
+		return ptypes[i] < ptypes[j]
+	})
+	return ptypes
+}
+
+func sortedRules(rules [][]string) [][]string {
+	sorted := make([][]string, len(rules))
+	copy(sorted, rules)
+	sort.Slice(sorted, func(i, j int) bool {
+		return strings.Join(sorted[i], "\x00") < strings.Join(sorted[j], "\x00")
+	})
+	return sorted
+}
+
+// csvField quotes the field if it could not be read back as is
+func csvField(field string) string {
+	if strings.ContainsAny(field, ",\"\r\n") || strings.TrimSpace(field) != field {
+		return `"` + strings.Replace(field, `"`, `""`, -1) + `"`
+	}
+	return field
+}
@@ -0,0 +1,182 @@
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+// failingAdapter loads nothing and fails to save
+type failingAdapter struct{}
+
+func (failingAdapter) LoadPolicy(model.Model) error { return nil }
+func (failingAdapter) SavePolicy(model.Model) error { return errors.New("save failed") }
+func (failingAdapter) AddPolicy(string, string, []string) error {
+	return nil
+}
+func (failingAdapter) RemovePolicy(string, string, []string) error {
+	return nil
+}
+func (failingAdapter) RemoveFilteredPolicy(string, string, int, ...string) error {
+	return nil
+}
+
+// partialAdapter saves the rules one by one like a table without transaction,
+// the next failures saves fail after writing limit rules
+type partialAdapter struct {
+	failingAdapter
+	rules    [][]string
+	limit    int
+	failures int
+}
+
+func (a *partialAdapter) SavePolicy(m model.Model) error {
+	a.rules = nil
+	for _, sec := range []string{"p", "g"} {
+		for ptype, assertion := range m[sec] {
+			for _, rule := range assertion.Policy {
+				if a.failures > 0 && len(a.rules) == a.limit {
+					a.failures--
+					return errors.New("connection lost")
+				}
+				a.rules = append(a.rules, append([]string{ptype}, rule...))
+			}
+		}
+	}
+	return nil
+}
+
+func newSnapshotManager(t *testing.T) *Manager {
+	mgr, err := NewManagerFromString(testModel, failingAdapter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = mgr.AddPolicy("admin", "/api/users/:id", "PUT"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = mgr.AddPolicy("viewer", "/api/users/:id", "GET"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = mgr.AddGroupingPolicy("user:1", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	return mgr
+}
+
+func TestSnapshot_CSV(t *testing.T) {
+	mgr := newSnapshotManager(t)
+	snapshot, err := mgr.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err = WriteCSV(&b, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "p, admin, /api/users/:id, PUT\np, viewer, /api/users/:id, GET\ng, user:1, admin\n" {
+		t.Error("bad csv", b.String())
+	}
+
+	b.WriteString("# comment\n\np, \"a, b\", \" c\", d\n")
+	read, err := ReadCSV(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read["p"]) != 3 || !reflect.DeepEqual(read["p"][2], []string{"a, b", "c", "d"}) {
+		t.Error("bad read", read)
+	}
+
+	b.Reset()
+	if err = WriteJSON(&b, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if read, err = ReadJSON(&b); err != nil || !DiffSnapshots(snapshot, read).Empty() {
+		t.Error("bad json round trip", read, err)
+	}
+}
+
+func TestManager_Apply(t *testing.T) {
+	mgr := newSnapshotManager(t)
+	target := Snapshot{
+		"p": {{"admin", "/api/users/:id", "PUT"}, {"admin", "/api/users/:id", "DELETE"}},
+		"g": {{"user:1", "admin"}, {"user:2", "admin"}},
+	}
+
+	diff, err := mgr.Diff(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.String() != "- p, viewer, /api/users/:id, GET\n+ p, admin, /api/users/:id, DELETE\n+ g, user:2, admin\n" {
+		t.Error("bad diff", diff.String())
+	}
+
+	// the adapter fails to save, the old policy is restored
+	if _, err = mgr.Apply(target); err == nil {
+		t.Fatal("apply should fail")
+	}
+	if allowed, _ := mgr.Enforce("user:2", "/api/users/1", "PUT"); allowed {
+		t.Error("failed apply changed the policy")
+	}
+	if allowed, _ := mgr.Enforce("viewer", "/api/users/1", "GET"); !allowed {
+		t.Error("failed apply did not restore the policy")
+	}
+
+	if _, err = mgr.Apply(Snapshot{"p": {{"admin", "/a"}}}); err == nil {
+		t.Error("invalid rule applied")
+	}
+	if _, err = mgr.Apply(Snapshot{"p9": {{"admin", "/a", "GET"}}}); err == nil {
+		t.Error("unknown ptype applied")
+	}
+
+	memory, err := NewManagerFromString(testModel, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := 0
+	memory.OnChange = func() { changes++ }
+	if diff, err = memory.Apply(target); err != nil || len(diff.Added["p"]) != 2 || len(diff.Added["g"]) != 2 {
+		t.Fatal("bad apply", diff, err)
+	}
+	if allowed, _ := memory.Enforce("user:2", "/api/users/1", "DELETE"); !allowed {
+		t.Error("applied policy not enforced")
+	}
+	if diff, err = memory.Apply(target); err != nil || !diff.Empty() || changes != 1 {
+		t.Error("applying the same policy changed it", diff, err, changes)
+	}
+}
+
+func TestManager_ApplyPartialSave(t *testing.T) {
+	adapter := &partialAdapter{limit: 1}
+	mgr, err := NewManagerFromString(testModel, adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := Snapshot{"p": {{"admin", "/api/users/:id", "PUT"}}, "g": {{"user:1", "admin"}}}
+	if _, err = mgr.Apply(current); err != nil {
+		t.Fatal(err)
+	}
+	target := Snapshot{"p": {{"viewer", "/api/users/:id", "GET"}, {"viewer", "/api/orders/:id", "GET"}}}
+
+	// the adapter fails after writing a part of the target, the old policy is saved back
+	adapter.failures = 1
+	if _, err = mgr.Apply(target); err == nil || strings.Contains(err.Error(), "restore failed") {
+		t.Fatal("bad apply", err)
+	}
+	if len(adapter.rules) != 2 || adapter.rules[0][1] != "admin" || adapter.rules[1][1] != "user:1" {
+		t.Error("partial policy left in the adapter", adapter.rules)
+	}
+
+	// the old policy can not be saved back either
+	adapter.failures = 2
+	if _, err = mgr.Apply(target); err == nil || !strings.Contains(err.Error(), "restore failed") {
+		t.Error("restore failure not reported", err)
+	}
+	if allowed, _ := mgr.Enforce("user:1", "/api/users/1", "PUT"); !allowed {
+		t.Error("failed apply did not restore the policy in memory")
+	}
+}
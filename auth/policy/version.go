@@ -0,0 +1,42 @@
+package policy
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// VersionFunc return the version of the policy source, any change of the
+// version makes Reloader.Sync reload the policy
+type VersionFunc func() (string, error)
+
+// FileVersion watches the modification time and size of the policy files,
+// e.g. the csv of a file adapter and the model
+func FileVersion(filenames ...string) VersionFunc {
+	return func() (string, error) {
+		versions := make([]string, len(filenames))
+		for i, filename := range filenames {
+			info, err := os.Stat(filename)
+			if err != nil {
+				return "", err
+			}
+			versions[i] = fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+		}
+		return strings.Join(versions, ","), nil
+	}
+}
+
+// SQLVersion polls a version row of the database, which every instance should
+// bump after changing the policy, e.g.
+//
+//	SQLVersion(db, "SELECT version FROM casbin_policy_version WHERE id = 1")
+func SQLVersion(db *sql.DB, query string, args ...interface{}) VersionFunc {
+	return func() (string, error) {
+		var version string
+		if err := db.QueryRow(query, args...).Scan(&version); err != nil {
+			return "", err
+		}
+		return version, nil
+	}
+}
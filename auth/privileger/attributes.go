@@ -0,0 +1,101 @@
+package privileger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Myriad-Dreamin/gin-middleware/auth/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// Attributes of the request for the attribute based matchers, e.g.
+//
+//	m = g(r.sub, p.sub) && keyMatch2(r.obj, p.obj) && r.act == p.act && (p.owner != "owner" || r.attr.Owner)
+type Attributes struct {
+	// Subject is the resolved subject
+	Subject string
+	// Claims set by jwt.Middleware, nil if missing
+	Claims *jwt.CustomClaims
+	// Params and Query are the path parameters and the first query values
+	Params map[string]string
+	Query  map[string]string
+	// ClientIP is given by the IPResolver of the middleware, match it with ipMatch of auth/policy
+	ClientIP string
+	// Time of the request, match it with timeWindow of auth/policy
+	Time time.Time
+	// Owner is set by OwnerParam
+	Owner bool
+	// Values are set by the custom Attributors
+	Values map[string]interface{}
+}
+
+// String formats the fields of the attributes for the decision headers and logs,
+// the claims are left out
+func (attrs *Attributes) String() string {
+	return fmt.Sprintf("{Subject:%s ClientIP:%s Time:%s Owner:%t Params:%v Query:%v Values:%v}",
+		attrs.Subject, attrs.ClientIP, attrs.Time.Format(time.RFC3339), attrs.Owner, attrs.Params, attrs.Query, attrs.Values)
+}
+
+// Attributor fills the attributes of the request
+type Attributor func(c *gin.Context, attrs *Attributes) error
+
+// OwnerParam sets Owner if the path parameter equals to the id of the requester,
+// e.g. OwnerParam("id", ClaimsField("", "UID")) for /users/:id
+func OwnerParam(param string, id SubjectResolver) Attributor {
+	return func(c *gin.Context, attrs *Attributes) error {
+		uid, err := id(c)
+		if err != nil {
+			return &IdentityError{Err: err}
+		}
+		attrs.Owner = len(uid) != 0 && c.Param(param) == uid
+		return nil
+	}
+}
+
+// ClaimsAttribute copies the value of the custom field of the claims into Values[name],
+// the path is the same as ClaimsField
+func ClaimsAttribute(name string, path ...string) Attributor {
+	return func(c *gin.Context, attrs *Attributes) error {
+		if attrs.Claims == nil {
+			return &IdentityError{Err: ErrMissingClaims}
+		}
+		if value, ok := lookupField(attrs.Claims.CustomField, path); ok {
+			attrs.Values[name] = value
+		}
+		return nil
+	}
+}
+
+func (middleware *MiddleWare) attributes(c *gin.Context, sub string) (*Attributes, error) {
+	attrs := &Attributes{
+		Subject:  sub,
+		Params:   make(map[string]string, len(c.Params)),
+		Query:    make(map[string]string),
+		ClientIP: middleware.clientIP(c),
+		Time:     time.Now(),
+		Values:   make(map[string]interface{}),
+	}
+	attrs.Claims, _ = contextClaims(c)
+	for _, param := range c.Params {
+		attrs.Params[param.Key] = param.Value
+	}
+	for key, values := range c.Request.URL.Query() {
+		if len(values) != 0 {
+			attrs.Query[key] = values[0]
+		}
+	}
+
+	for _, attributor := range middleware.Attributors {
+		if err := attributor(c, attrs); err != nil {
+			return nil, err
+		}
+	}
+	return attrs, nil
+}
+
+func (middleware *MiddleWare) clientIP(c *gin.Context) string {
+	if middleware.IPResolver != nil {
+		return middleware.IPResolver(c)
+	}
+	return RemoteIP(c)
+}
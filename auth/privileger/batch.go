@@ -0,0 +1,89 @@
+package privileger
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Myriad-Dreamin/gin-middleware/auth/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// BatchValidator evaluates many requests at once, e.g. casbin.Enforcer.BatchEnforce
+type BatchValidator interface {
+	BatchEnforce(requests [][]interface{}) ([]bool, error)
+}
+
+// PermissionsRequest is the body of PermissionsHandler
+type PermissionsRequest struct {
+	Permissions []Permission `json:"permissions" binding:"required,dive"`
+}
+
+// PermissionsResponse maps the requested objects and actions to the decisions
+type PermissionsResponse struct {
+	Permissions map[string]map[string]bool `json:"permissions"`
+}
+
+// CheckMany return the decision of every permission for the subject of the request,
+// e.g. to decide which buttons the frontend shows
+func (middleware *MiddleWare) CheckMany(c *gin.Context, permissions []Permission) ([]bool, error) {
+	requests := make([][]interface{}, len(permissions))
+	for i, permission := range permissions {
+		rvals, err := middleware.requestValues(c, permission)
+		if err != nil {
+			return nil, err
+		}
+		requests[i] = rvals
+	}
+
+	if v, ok := middleware.v.(BatchValidator); ok && middleware.Cache == nil {
+		return v.BatchEnforce(requests)
+	}
+
+	results := make([]bool, len(requests))
+	for i, rvals := range requests {
+		decision := &Decision{Request: rvals, Time: time.Now()}
+		if middleware.enforce(decision); decision.Err != nil {
+			return nil, decision.Err
+		}
+		results[i] = decision.Allowed
+	}
+	return results, nil
+}
+
+// PermissionsHandler return a handler evaluating the PermissionsRequest in body for
+// the subject of the request. Mind that the route of the handler is enforced as well
+// if it is behind the middleware
+func (middleware *MiddleWare) PermissionsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req PermissionsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, jwt.UnauthorizedMessage{
+				Code: -1,
+				Msg:  err.Error(),
+			})
+			return
+		}
+
+		results, err := middleware.CheckMany(c, req.Permissions)
+		if err != nil {
+			if _, isIdentityErr := err.(*IdentityError); isIdentityErr {
+				middleware.onError(c, http.StatusUnauthorized, err)
+			} else {
+				middleware.onError(c, http.StatusInternalServerError, err)
+			}
+			c.Abort()
+			return
+		}
+
+		resp := PermissionsResponse{Permissions: make(map[string]map[string]bool)}
+		for i, permission := range req.Permissions {
+			actions, ok := resp.Permissions[permission.Object]
+			if !ok {
+				actions = make(map[string]bool)
+				resp.Permissions[permission.Object] = actions
+			}
+			actions[permission.Action] = results[i]
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,117 @@
+package privileger
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DecisionCache is a LRU cache with TTL of the decisions of the validator,
+// keyed on the request values (sub, obj, act[, dom])
+type DecisionCache struct {
+	size int
+	ttl  time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+
+	// generation is bumped by Invalidate, the decisions evaluated
+	// before it are dropped by put
+	generation uint64
+
+	hits   uint64
+	misses uint64
+}
+
+type decisionEntry struct {
+	key      string
+	allowed  bool
+	expireAt time.Time
+}
+
+// NewDecisionCache return a cache holding at most size decisions for ttl each
+func NewDecisionCache(size int, ttl time.Duration) *DecisionCache {
+	return &DecisionCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Invalidate drops every decision, it should be called whenever the policy changes
+func (cache *DecisionCache) Invalidate() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.entries = make(map[string]*list.Element)
+	cache.order.Init()
+	cache.generation++
+}
+
+// Stats return the number of hits and misses since the cache was created
+func (cache *DecisionCache) Stats() (hits, misses uint64) {
+	return atomic.LoadUint64(&cache.hits), atomic.LoadUint64(&cache.misses)
+}
+
+// Len return the number of cached decisions
+func (cache *DecisionCache) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.order.Len()
+}
+
+// get return the cached decision, or the generation to put the decision with on a miss
+func (cache *DecisionCache) get(key string) (allowed bool, ok bool, generation uint64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if element, has := cache.entries[key]; has {
+		entry := element.Value.(*decisionEntry)
+		if time.Now().Before(entry.expireAt) {
+			cache.order.MoveToFront(element)
+			atomic.AddUint64(&cache.hits, 1)
+			return entry.allowed, true, cache.generation
+		}
+		cache.order.Remove(element)
+		delete(cache.entries, key)
+	}
+	atomic.AddUint64(&cache.misses, 1)
+	return false, false, cache.generation
+}
+
+// put caches the decision unless the cache is invalidated since the generation,
+// as the decision may be evaluated on the old policy
+func (cache *DecisionCache) put(key string, allowed bool, generation uint64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if generation != cache.generation {
+		return
+	}
+	entry := &decisionEntry{key: key, allowed: allowed, expireAt: time.Now().Add(cache.ttl)}
+	if element, has := cache.entries[key]; has {
+		element.Value = entry
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.entries[key] = cache.order.PushFront(entry)
+	for cache.order.Len() > cache.size {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*decisionEntry).key)
+	}
+}
+
+// cacheKey joins the request values, only the string values are cacheable
+func cacheKey(rvals []interface{}) (string, bool) {
+	parts := make([]string, len(rvals))
+	for i, rval := range rvals {
+		s, ok := rval.(string)
+		if !ok {
+			return "", false
+		}
+		parts[i] = s
+	}
+	return strings.Join(parts, "\x00"), true
+}
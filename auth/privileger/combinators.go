@@ -0,0 +1,66 @@
+package privileger
+
+// ValidatorFunc adapts a function to Validator
+type ValidatorFunc func(rvals ...interface{}) (bool, error)
+
+func (f ValidatorFunc) Enforce(rvals ...interface{}) (bool, error) {
+	return f(rvals...)
+}
+
+// Static return a Validator with a fixed decision,
+// e.g. Static(false) as a maintenance mode kill switch
+func Static(allowed bool) Validator {
+	return ValidatorFunc(func(...interface{}) (bool, error) {
+		return allowed, nil
+	})
+}
+
+// AnyOf allows the request if one of the validators allows it,
+// the first error is returned only if none allows
+func AnyOf(validators ...Validator) Validator {
+	return ValidatorFunc(func(rvals ...interface{}) (bool, error) {
+		var firstErr error
+		for _, v := range validators {
+			allowed, err := v.Enforce(rvals...)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			if allowed {
+				return true, nil
+			}
+		}
+		return false, firstErr
+	})
+}
+
+// AllOf allows the request if every validator allows it, it stops at the
+// first denial or error. Like AnyOf, AllOf with no validators denies every
+// request so that an empty list built at runtime never opens the route
+func AllOf(validators ...Validator) Validator {
+	return ValidatorFunc(func(rvals ...interface{}) (bool, error) {
+		if len(validators) == 0 {
+			return false, nil
+		}
+		for _, v := range validators {
+			allowed, err := v.Enforce(rvals...)
+			if err != nil || !allowed {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+}
+
+// Not inverts the decision of the validator, the request is denied on error
+func Not(v Validator) Validator {
+	return ValidatorFunc(func(rvals ...interface{}) (bool, error) {
+		allowed, err := v.Enforce(rvals...)
+		if err != nil {
+			return false, err
+		}
+		return !allowed, nil
+	})
+}
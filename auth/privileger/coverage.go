@@ -0,0 +1,180 @@
+package privileger
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// coverageProbe is a subject unknown to any policy, it is allowed only if everyone is
+const coverageProbe = "\x00privileger-coverage-probe"
+
+// SubjectLister lists the subjects and roles known by the validator, e.g. casbin.Enforcer
+type SubjectLister interface {
+	GetAllSubjects() ([]string, error)
+	GetAllRoles() ([]string, error)
+}
+
+// RouteReport is the coverage of a route by the policy
+type RouteReport struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Object string `json:"object"`
+	Action string `json:"action"`
+	// Declared is true if the permission comes from the RouteRegistry
+	Declared bool `json:"declared"`
+	// Undeclared is true if the route is missing in the RouteRegistry and denied
+	// by DenyUndeclared, the object and action are empty then
+	Undeclared bool `json:"undeclared"`
+	// AllowedSubjects are the known subjects and roles allowed to access the route
+	AllowedSubjects []string `json:"allowed_subjects"`
+	// Unreachable is true if no known subject is allowed
+	Unreachable bool `json:"unreachable"`
+	// Public is true if a subject unknown to the policy is allowed, i.e. everyone is
+	Public bool `json:"public"`
+}
+
+// RoutesWithPrefix filters the routes of gin.Engine.Routes() mounted under the prefix,
+// e.g. the group using the middleware
+func RoutesWithPrefix(routes gin.RoutesInfo, prefix string) gin.RoutesInfo {
+	var filtered gin.RoutesInfo
+	for _, route := range routes {
+		if strings.HasPrefix(route.Path, prefix) {
+			filtered = append(filtered, route)
+		}
+	}
+	return filtered
+}
+
+// Coverage evaluates the policy of every route for the subjects, the subjects and
+// roles of the validator are added if it is a SubjectLister. The routes are
+// enforced on their templates, e.g. /api/users/:id
+func (middleware *MiddleWare) Coverage(routes gin.RoutesInfo, subjects ...string) ([]RouteReport, error) {
+	if middleware.DomainResolver != nil {
+		return nil, ErrDomainCoverage
+	}
+	if lister, ok := middleware.v.(SubjectLister); ok {
+		known, err := lister.GetAllSubjects()
+		if err != nil {
+			return nil, err
+		}
+		roles, err := lister.GetAllRoles()
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(append(subjects, known...), roles...)
+	}
+	subjects = uniqueStrings(subjects)
+
+	reports := make([]RouteReport, 0, len(routes))
+	for _, route := range routes {
+		report, err := middleware.routeReport(route, subjects)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func (middleware *MiddleWare) routeReport(route gin.RouteInfo, subjects []string) (RouteReport, error) {
+	report := RouteReport{Method: route.Method, Path: route.Path}
+
+	var permission Permission
+	if middleware.Routes != nil {
+		permission, report.Declared = middleware.Routes.Lookup(route.Method, route.Path)
+		if !report.Declared && middleware.DenyUndeclared {
+			report.Undeclared, report.Unreachable = true, true
+			return report, nil
+		}
+	}
+	if !report.Declared {
+		c, _ := gin.CreateTestContext(nil)
+		req, err := http.NewRequest(route.Method, route.Path, nil)
+		if err != nil {
+			return report, err
+		}
+		c.Request = req
+		permission = middleware.resolvePermission(c)
+	}
+	report.Object, report.Action = permission.Object, permission.Action
+
+	public, err := middleware.v.Enforce(middleware.probeValues(coverageProbe, permission)...)
+	if err != nil {
+		return report, err
+	}
+	report.Public = public
+
+	for _, sub := range subjects {
+		allowed, err := middleware.v.Enforce(middleware.probeValues(sub, permission)...)
+		if err != nil {
+			return report, err
+		}
+		if allowed {
+			report.AllowedSubjects = append(report.AllowedSubjects, sub)
+		}
+	}
+	report.Unreachable = !public && len(report.AllowedSubjects) == 0
+	return report, nil
+}
+
+// probeValues return the arguments of Validator.Enforce without a request,
+// the Attributes are empty in ABAC mode
+func (middleware *MiddleWare) probeValues(sub string, permission Permission) []interface{} {
+	rvals := []interface{}{sub, permission.Object, permission.Action}
+	if middleware.ABAC {
+		rvals = append(rvals, &Attributes{Subject: sub, Values: map[string]interface{}{}})
+	}
+	return rvals
+}
+
+// WritePolicySkeleton writes a Casbin policy CSV with a line per object and action
+// of the reports, the unreachable ones granted to the placeholder subject and the
+// others commented out with the subjects already allowed
+func WritePolicySkeleton(w io.Writer, reports []RouteReport, placeholder string) error {
+	written := make(map[Permission]bool)
+	for _, report := range reports {
+		if report.Undeclared {
+			if _, err := fmt.Fprintf(w, "# %s %s is denied as undeclared, declare it in the RouteRegistry\n",
+				report.Method, report.Path); err != nil {
+				return err
+			}
+			continue
+		}
+		permission := Permission{Object: report.Object, Action: report.Action}
+		if written[permission] {
+			continue
+		}
+		written[permission] = true
+
+		var err error
+		switch {
+		case report.Unreachable:
+			_, err = fmt.Fprintf(w, "p, %s, %s, %s\n", placeholder, report.Object, report.Action)
+		case report.Public:
+			_, err = fmt.Fprintf(w, "# p, %s, %s, %s # public\n", placeholder, report.Object, report.Action)
+		default:
+			_, err = fmt.Fprintf(w, "# p, %s, %s, %s # allowed for %s\n",
+				placeholder, report.Object, report.Action, strings.Join(report.AllowedSubjects, " "))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,91 @@
+package privileger
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DecisionKey is the key of the *Decision in gin context set by MiddleWare.Build
+const DecisionKey = "privileger-decision"
+
+const (
+	// DecisionHeader is the response header of the decision in debug mode
+	DecisionHeader = "Gin-Context-Privileger-Decision"
+	// MatchedRuleHeader is the response header of the matched policy rule in debug mode
+	MatchedRuleHeader = "Gin-Context-Privileger-Matched-Rule"
+)
+
+// ExplainingValidator is a Validator which also returns the policy rule that
+// decided the request, e.g. casbin.Enforcer.EnforceEx
+type ExplainingValidator interface {
+	Validator
+	EnforceEx(...interface{}) (bool, []string, error)
+}
+
+// Decision records the evaluation of the policy for a request
+type Decision struct {
+	// Request is the arguments passed to the validator, empty if they could not be resolved
+	Request []interface{}
+	Allowed bool
+	// Explain is the matched policy rule if the validator is an ExplainingValidator
+	Explain []string
+	// Cached is true if the decision came from the DecisionCache, which has no Explain
+	Cached bool
+	Err    error
+	DryRun bool
+	Time   time.Time
+}
+
+func (decision *Decision) String() string {
+	result := "deny"
+	if decision.Err != nil {
+		result = "error: " + decision.Err.Error()
+	} else if decision.Allowed {
+		result = "allow"
+	}
+	if decision.DryRun {
+		result = "dry-run " + result
+	}
+	return fmt.Sprintf("%s %v by %v", result, decision.Request, decision.Explain)
+}
+
+// GetDecision return the decision of the request made by MiddleWare.Build
+func GetDecision(c *gin.Context) (*Decision, bool) {
+	value, ok := c.Get(DecisionKey)
+	if !ok {
+		return nil, false
+	}
+	decision, ok := value.(*Decision)
+	return decision, ok
+}
+
+func writeDecisionHeader(c *gin.Context, decision *Decision) {
+	c.Header(DecisionHeader, decision.String())
+	if len(decision.Explain) != 0 {
+		c.Header(MatchedRuleHeader, strings.Join(decision.Explain, ", "))
+	}
+}
+
+// DecisionLogger records the decisions of the middleware
+type DecisionLogger interface {
+	LogDecision(c *gin.Context, decision *Decision)
+}
+
+// DecisionLoggerFunc adapts a function to DecisionLogger
+type DecisionLoggerFunc func(c *gin.Context, decision *Decision)
+
+func (f DecisionLoggerFunc) LogDecision(c *gin.Context, decision *Decision) {
+	f(c, decision)
+}
+
+// WriterLogger return a DecisionLogger writing a line per decision to w
+func WriterLogger(w io.Writer) DecisionLogger {
+	return DecisionLoggerFunc(func(c *gin.Context, decision *Decision) {
+		_, _ = fmt.Fprintf(w, "[privileger] %v | %s %s | %s\n",
+			decision.Time.Format("2006/01/02 - 15:04:05"), c.Request.Method, c.Request.URL.Path, decision)
+	})
+}
@@ -0,0 +1,49 @@
+package privileger
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// DomainResolver return the domain (organization, tenant) of the request to enforce in,
+// the error is treated as an IdentityError
+type DomainResolver func(c *gin.Context) (string, error)
+
+// HostDomain uses the request host as the domain
+func HostDomain(c *gin.Context) (string, error) {
+	if len(c.Request.Host) == 0 {
+		return "", ErrMissingDomain
+	}
+	return c.Request.Host, nil
+}
+
+// HeaderDomain reads the domain from the request header
+func HeaderDomain(header string) DomainResolver {
+	return func(c *gin.Context) (string, error) {
+		if dom := c.GetHeader(header); len(dom) != 0 {
+			return dom, nil
+		}
+		return "", ErrMissingDomain
+	}
+}
+
+// ParamDomain reads the domain from the path parameter, e.g. ParamDomain("org") for /orgs/:org/...
+func ParamDomain(param string) DomainResolver {
+	return func(c *gin.Context) (string, error) {
+		if dom := c.Param(param); len(dom) != 0 {
+			return dom, nil
+		}
+		return "", ErrMissingDomain
+	}
+}
+
+// ClaimsDomain reads the domain from the custom field of the claims set by
+// jwt.Middleware, the path is the same as ClaimsField
+func ClaimsDomain(path ...string) DomainResolver {
+	return func(c *gin.Context) (string, error) {
+		dom, err := ClaimsField("", path...)(c)
+		if err == ErrMissingSubject {
+			return "", ErrMissingDomain
+		}
+		return dom, err
+	}
+}
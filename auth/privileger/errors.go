@@ -0,0 +1,36 @@
+package privileger
+
+import "errors"
+
+var (
+	// ErrMissingSubject indicates the subject of request could not be resolved
+	ErrMissingSubject = errors.New("missing subject")
+
+	// ErrMissingClaims indicates the jwt claims are not in the context, jwt.Middleware should be used before privileger
+	ErrMissingClaims = errors.New("missing jwt claims")
+
+	// ErrMissingDomain indicates the domain of request could not be resolved
+	ErrMissingDomain = errors.New("missing domain")
+
+	// ErrUndeclaredRoute explains the denial of a route missing in the RouteRegistry
+	ErrUndeclaredRoute = errors.New("route has no declared permission")
+
+	// ErrDomainCoverage indicates the coverage report does not support the RBAC with domains
+	ErrDomainCoverage = errors.New("coverage is not supported with domains")
+
+	// ErrUnsupportedPolicyFormat indicates the policy file is neither json nor yaml
+	ErrUnsupportedPolicyFormat = errors.New("unsupported policy format")
+
+	// ErrUnsupportedRequest indicates MemoryValidator got arguments other than (sub, obj, act)
+	ErrUnsupportedRequest = errors.New("unsupported request, want (sub, obj, act)")
+)
+
+// IdentityError indicates the subject of request could not be resolved,
+// which is an authentication problem rather than an authorization one
+type IdentityError struct {
+	Err error
+}
+
+func (e *IdentityError) Error() string {
+	return e.Err.Error()
+}
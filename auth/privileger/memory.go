@@ -0,0 +1,166 @@
+package privileger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// MemoryPolicy is the policy of MemoryValidator, e.g. in YAML
+//
+//	roles:
+//	  user:1: [admin]
+//	  admin: [viewer]
+//	rules:
+//	  - subject: viewer
+//	    object: /api/users/*
+//	    actions: [GET, HEAD]
+//	  - subject: admin
+//	    object: /api/**
+//	    actions: ["*"]
+type MemoryPolicy struct {
+	// Roles maps a subject or a role to the roles it inherits
+	Roles map[string][]string `json:"roles" yaml:"roles"`
+	Rules []MemoryRule        `json:"rules" yaml:"rules"`
+}
+
+// MemoryRule allows the subject to take the actions on the objects matching the pattern.
+// The pattern is matched per path segment, a segment of pattern can be a glob of
+// path.Match, a route parameter like :id matching any segment, or ** matching the rest
+type MemoryRule struct {
+	Subject string   `json:"subject" yaml:"subject"`
+	Object  string   `json:"object" yaml:"object"`
+	Actions []string `json:"actions" yaml:"actions"`
+}
+
+// MemoryValidator is a Validator with role hierarchy, glob objects and action sets
+// in memory, for small services and tests. It enforces on (sub, obj, act) and
+// ignores the Attributes of ABAC mode
+type MemoryValidator struct {
+	policy MemoryPolicy
+}
+
+// NewMemoryValidator return a validator of the policy
+func NewMemoryValidator(policy MemoryPolicy) *MemoryValidator {
+	return &MemoryValidator{policy: policy}
+}
+
+// LoadMemoryValidator reads the policy from a .json, .yaml or .yml file
+func LoadMemoryValidator(filename string) (*MemoryValidator, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy MemoryPolicy
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		err = json.Unmarshal(data, &policy)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &policy)
+	default:
+		return nil, ErrUnsupportedPolicyFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewMemoryValidator(policy), nil
+}
+
+func (v *MemoryValidator) Enforce(rvals ...interface{}) (bool, error) {
+	allowed, _, err := v.EnforceEx(rvals...)
+	return allowed, err
+}
+
+func (v *MemoryValidator) EnforceEx(rvals ...interface{}) (bool, []string, error) {
+	if len(rvals) == 4 {
+		if _, ok := rvals[3].(*Attributes); ok {
+			rvals = rvals[:3]
+		}
+	}
+	if len(rvals) != 3 {
+		return false, nil, ErrUnsupportedRequest
+	}
+	sub, ok1 := rvals[0].(string)
+	obj, ok2 := rvals[1].(string)
+	act, ok3 := rvals[2].(string)
+	if !ok1 || !ok2 || !ok3 {
+		return false, nil, ErrUnsupportedRequest
+	}
+
+	subjects := v.inherited(sub)
+	for _, rule := range v.policy.Rules {
+		if subjects[rule.Subject] && matchObject(rule.Object, obj) && matchAction(rule.Actions, act) {
+			return true, []string{rule.Subject, rule.Object, strings.Join(rule.Actions, "|")}, nil
+		}
+	}
+	return false, nil, nil
+}
+
+// GetAllSubjects return the subjects of the rules
+func (v *MemoryValidator) GetAllSubjects() ([]string, error) {
+	var subjects []string
+	for _, rule := range v.policy.Rules {
+		subjects = append(subjects, rule.Subject)
+	}
+	return uniqueStrings(subjects), nil
+}
+
+// GetAllRoles return the roles inherited by any subject
+func (v *MemoryValidator) GetAllRoles() ([]string, error) {
+	var roles []string
+	for _, inherited := range v.policy.Roles {
+		roles = append(roles, inherited...)
+	}
+	return uniqueStrings(roles), nil
+}
+
+// inherited return the subject with all the roles it inherits directly or not
+func (v *MemoryValidator) inherited(sub string) map[string]bool {
+	subjects := map[string]bool{sub: true}
+	stack := []string{sub}
+	for len(stack) != 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, role := range v.policy.Roles[current] {
+			if !subjects[role] {
+				subjects[role] = true
+				stack = append(stack, role)
+			}
+		}
+	}
+	return subjects
+}
+
+func matchObject(pattern, obj string) bool {
+	patterns := strings.Split(strings.Trim(pattern, "/"), "/")
+	segments := strings.Split(strings.Trim(obj, "/"), "/")
+	for i, p := range patterns {
+		if p == "**" {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if strings.HasPrefix(p, ":") {
+			continue
+		}
+		if matched, err := path.Match(p, segments[i]); err != nil || !matched {
+			return false
+		}
+	}
+	return len(patterns) == len(segments)
+}
+
+func matchAction(actions []string, act string) bool {
+	for _, action := range actions {
+		if action == "*" || strings.EqualFold(action, act) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,9 +1,10 @@
 package privileger
 
 import (
-	"errors"
 	"net/http"
+	"time"
 
+	"github.com/Myriad-Dreamin/gin-middleware/auth/jwt"
 	"github.com/gin-gonic/gin"
 )
 
@@ -11,37 +12,255 @@ type Validator interface {
 	Enforce(...interface{}) (bool, error)
 }
 
+// DenyHandler writes the response when the policy denies the request
+type DenyHandler func(c *gin.Context)
+
+// ErrorHandler writes the response when the permission could not be checked,
+// status is 401 for an IdentityError and 500 otherwise
+type ErrorHandler func(c *gin.Context, status int, err error)
+
 // MiddleWare does not check the identity of user
 type MiddleWare struct {
-	v      Validator
-	uTable string
-	idKey string
+	v Validator
+
+	// SubjectResolver picks the subject to enforce on, NewMiddleWare reads it
+	// from the context value of idKey with uTable as prefix
+	SubjectResolver SubjectResolver
+
+	// ObjectResolver and ActionResolver pick the object and the action to
+	// enforce on, the request path and method are used if they are nil
+	ObjectResolver ObjectResolver
+	ActionResolver ActionResolver
+
+	// DomainResolver enables the RBAC with domains, the domain is passed to the
+	// validator as the second argument like the request r = sub, dom, obj, act
+	DomainResolver DomainResolver
+
+	// Cache keeps the decisions of the validator if it is not nil,
+	// call Invalidate when the policy changes
+	Cache *DecisionCache
+
+	// Logger records every decision, the requests are never blocked in DryRun
+	// mode so that new policies can be rolled out safely
+	Logger DecisionLogger
+	DryRun bool
+
+	// ABAC passes the *Attributes of the request to the validator as the last
+	// argument, e.g. r = sub, obj, act, attr, filled by the Attributors
+	ABAC        bool
+	Attributors []Attributor
+
+	// IPResolver picks the ClientIP of the Attributes, RemoteIP is used if it is nil,
+	// set ForwardedIP behind a trusted proxy
+	IPResolver IPResolver
+
+	// Routes declares the permission per route template, the routes missing in
+	// it are denied if DenyUndeclared or enforced on the resolved object and action
+	Routes         *RouteRegistry
+	DenyUndeclared bool
+
+	// Debug writes the decision into the response headers, e.g.
+	//     middleware.Debug = gin.IsDebugging()
+	Debug bool
+
+	// OnDeny and OnError write the response of the rejected request,
+	// a jwt.UnauthorizedMessage is responded if they are nil
+	OnDeny  DenyHandler
+	OnError ErrorHandler
+}
+
+func NewMiddleWare(v Validator, uTable, idKey string) *MiddleWare {
+	return NewMiddleWareWithResolver(v, ContextKey(uTable, idKey))
 }
 
-func NewMiddleWare(v Validator, uTable,idKey string) *MiddleWare {
+// NewMiddleWareWithResolver return the middleware enforcing on the subject
+// given by the resolver, e.g. ClaimsSubject("user:") after jwt.Middleware
+func NewMiddleWareWithResolver(v Validator, subjectResolver SubjectResolver) *MiddleWare {
 	return &MiddleWare{
-		v:      v,
-		uTable: uTable,
-		idKey: idKey,
+		v:               v,
+		SubjectResolver: subjectResolver,
 	}
 }
 
+// Build return the middleware which responds 401 if the subject is missing,
+// 403 if the policy denies and 500 if the validator fails
 func (middleware *MiddleWare) Build() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if ok, err := middleware.CheckPermission(c); err != nil {
-			_ = c.AbortWithError(http.StatusForbidden, err)
-			return
-		} else if !ok {
-			c.AbortWithStatus(http.StatusUnauthorized)
-			return
+		middleware.respond(c, middleware.Decide(c))
+	}
+}
+
+// Require return a route level middleware enforcing the permission instead of
+// the one resolved from the request, e.g.
+//
+//	router.PUT("/orders/:id", authmw.Require("orders", "write"), handler)
+func (middleware *MiddleWare) Require(object, action string) gin.HandlerFunc {
+	permission := Permission{Object: object, Action: action}
+	return func(c *gin.Context) {
+		middleware.respond(c, middleware.decide(c, permission))
+	}
+}
+
+func (middleware *MiddleWare) respond(c *gin.Context, decision *Decision) {
+	c.Set(DecisionKey, decision)
+	if middleware.Debug {
+		writeDecisionHeader(c, decision)
+	}
+	if middleware.Logger != nil {
+		middleware.Logger.LogDecision(c, decision)
+	}
+	if middleware.DryRun {
+		return
+	}
+
+	if decision.Err != nil {
+		if _, isIdentityErr := decision.Err.(*IdentityError); isIdentityErr {
+			middleware.onError(c, http.StatusUnauthorized, decision.Err)
+		} else {
+			middleware.onError(c, http.StatusInternalServerError, decision.Err)
 		}
+		c.Abort()
+		return
+	} else if !decision.Allowed {
+		middleware.onDeny(c)
+		c.Abort()
+		return
 	}
 }
 
 func (middleware *MiddleWare) CheckPermission(c *gin.Context) (bool, error) {
-	var uid string
-	if uid = c.GetString(middleware.idKey); len(uid) == 0 {
-		return false, errors.New("missing uid")
+	decision := middleware.Decide(c)
+	return decision.Allowed, decision.Err
+}
+
+// Decide evaluates the policy for the request without responding
+func (middleware *MiddleWare) Decide(c *gin.Context) *Decision {
+	if middleware.Routes == nil {
+		return middleware.decide(c, middleware.resolvePermission(c))
+	}
+
+	if permission, ok := middleware.Routes.Lookup(c.Request.Method, c.FullPath()); ok {
+		return middleware.decide(c, permission)
+	}
+	if middleware.DenyUndeclared {
+		decision := &Decision{DryRun: middleware.DryRun, Time: time.Now()}
+		// the missing identity is responded with 401 before the denial
+		if _, err := middleware.SubjectResolver(c); err != nil {
+			decision.Err = &IdentityError{Err: err}
+			return decision
+		}
+		decision.Explain = []string{ErrUndeclaredRoute.Error()}
+		return decision
+	}
+	return middleware.decide(c, middleware.resolvePermission(c))
+}
+
+func (middleware *MiddleWare) decide(c *gin.Context, permission Permission) *Decision {
+	decision := &Decision{DryRun: middleware.DryRun, Time: time.Now()}
+	if decision.Request, decision.Err = middleware.requestValues(c, permission); decision.Err == nil {
+		middleware.enforce(decision)
+	}
+	return decision
+}
+
+// Invalidate drops the cached decisions
+func (middleware *MiddleWare) Invalidate() {
+	if middleware.Cache != nil {
+		middleware.Cache.Invalidate()
+	}
+}
+
+func (middleware *MiddleWare) enforce(decision *Decision) {
+	key, cacheable, generation := "", false, uint64(0)
+	if middleware.Cache != nil {
+		key, cacheable = cacheKey(decision.Request)
+	}
+	if cacheable {
+		if decision.Allowed, decision.Cached, generation = middleware.Cache.get(key); decision.Cached {
+			return
+		}
+	}
+
+	if v, ok := middleware.v.(ExplainingValidator); ok {
+		decision.Allowed, decision.Explain, decision.Err = v.EnforceEx(decision.Request...)
+	} else {
+		decision.Allowed, decision.Err = middleware.v.Enforce(decision.Request...)
+	}
+	if cacheable && decision.Err == nil {
+		middleware.Cache.put(key, decision.Allowed, generation)
+	}
+}
+
+// requestValues return the arguments of Validator.Enforce for the request,
+// (sub, obj, act) or (sub, dom, obj, act) if the DomainResolver is set,
+// followed by the *Attributes in ABAC mode
+func (middleware *MiddleWare) requestValues(c *gin.Context, permission Permission) ([]interface{}, error) {
+	sub, err := middleware.SubjectResolver(c)
+	if err != nil {
+		return nil, &IdentityError{Err: err}
+	}
+	rvals := []interface{}{sub, permission.Object, permission.Action}
+
+	if middleware.DomainResolver != nil {
+		dom, err := middleware.DomainResolver(c)
+		if err != nil {
+			return nil, &IdentityError{Err: err}
+		}
+		rvals = []interface{}{sub, dom, permission.Object, permission.Action}
+	}
+
+	if middleware.ABAC {
+		attrs, err := middleware.attributes(c, sub)
+		if err != nil {
+			return nil, err
+		}
+		rvals = append(rvals, attrs)
+	}
+	return rvals, nil
+}
+
+func (middleware *MiddleWare) resolvePermission(c *gin.Context) Permission {
+	return Permission{Object: middleware.object(c), Action: middleware.action(c)}
+}
+
+func (middleware *MiddleWare) onDeny(c *gin.Context) {
+	if middleware.OnDeny != nil {
+		middleware.OnDeny(c)
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, jwt.UnauthorizedMessage{
+		Code: -1,
+		Msg:  jwt.ErrForbidden.Error(),
+	})
+}
+
+func (middleware *MiddleWare) onError(c *gin.Context, status int, err error) {
+	if middleware.OnError != nil {
+		middleware.OnError(c, status, err)
+		return
+	}
+	_ = c.Error(err)
+	msg := err.Error()
+	if status == http.StatusInternalServerError {
+		// do not leak the details of validator
+		msg = http.StatusText(status)
+	}
+	c.AbortWithStatusJSON(status, jwt.UnauthorizedMessage{
+		Code: -1,
+		Msg:  msg,
+	})
+}
+
+func (middleware *MiddleWare) object(c *gin.Context) string {
+	if middleware.ObjectResolver != nil {
+		return middleware.ObjectResolver(c)
+	}
+	return RequestPath(c)
+}
+
+func (middleware *MiddleWare) action(c *gin.Context) string {
+	if middleware.ActionResolver != nil {
+		return middleware.ActionResolver(c)
 	}
-	return middleware.v.Enforce(middleware.uTable+uid, c.Request.URL.Path, c.Request.Method)
+	return RequestMethod(c)
 }
@@ -0,0 +1,659 @@
+package privileger
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Myriad-Dreamin/gin-middleware/auth/jwt"
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/gin-gonic/gin"
+)
+
+var _ SubjectLister = (*casbin.Enforcer)(nil)
+
+// policyValidator allows the requests whose arguments joined by space are in the set
+type policyValidator map[string]bool
+
+func (v policyValidator) Enforce(rvals ...interface{}) (bool, error) {
+	return v[joinValues(rvals)], nil
+}
+
+func joinValues(rvals []interface{}) string {
+	var args []string
+	for _, rval := range rvals {
+		s, _ := rval.(string)
+		args = append(args, s)
+	}
+	return strings.Join(args, " ")
+}
+
+func serve(r *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func newTestRouter(middleware *MiddleWare, uid string) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if len(uid) != 0 {
+			c.Set("uid", uid)
+		}
+	})
+	r.Use(middleware.Build())
+	ok := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	}
+	r.GET("/api/users/:id", ok)
+	r.PUT("/api/users/:id", ok)
+	return r
+}
+
+func TestMiddleWare_Resolvers(t *testing.T) {
+	mw := NewMiddleWare(policyValidator{
+		"user:1 /api/users/:id read": true,
+	}, "user:", "uid")
+	mw.ObjectResolver = FullPath
+	mw.ActionResolver = CRUDAction
+	r := newTestRouter(mw, "1")
+
+	if w := serve(r, "GET", "/api/users/42"); w.Code != http.StatusOK {
+		t.Error("bad code", w.Code)
+	}
+	if w := serve(r, "GET", "/api/users/43"); w.Code != http.StatusOK {
+		t.Error("bad code", w.Code)
+	}
+	if w := serve(r, "PUT", "/api/users/42"); w.Code == http.StatusOK {
+		t.Error("update allowed by read policy")
+	}
+}
+
+func TestSubjectResolvers(t *testing.T) {
+	type customField struct {
+		UID  int
+		Info map[string]interface{}
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("uid", 42)
+	c.Set(jwt.ClaimsKey, &jwt.CustomClaims{
+		StandardClaims: jwt.StandardClaims{Subject: "7"},
+		CustomField: &customField{
+			UID:  8,
+			Info: map[string]interface{}{"org": "myriad"},
+		},
+	})
+
+	for _, tc := range []struct {
+		resolver SubjectResolver
+		sub      string
+		err      error
+	}{
+		{ContextKey("user:", "uid"), "user:42", nil},
+		{ContextKey("user:", "missing"), "", ErrMissingSubject},
+		{ClaimsSubject("user:"), "user:7", nil},
+		{ClaimsField("user:", "UID"), "user:8", nil},
+		{ClaimsField("org:", "Info", "org"), "org:myriad", nil},
+		{ClaimsField("user:", "Info", "missing"), "", ErrMissingSubject},
+	} {
+		sub, err := tc.resolver(c)
+		if sub != tc.sub || err != tc.err {
+			t.Error("bad subject", sub, err, "want", tc.sub, tc.err)
+		}
+	}
+}
+
+type failingValidator struct{}
+
+func (failingValidator) Enforce(...interface{}) (bool, error) {
+	return false, errors.New("adapter is down")
+}
+
+func TestMiddleWare_Build(t *testing.T) {
+	allow := NewMiddleWare(policyValidator{"user:1 /api/users/42 GET": true}, "user:", "uid")
+	for _, tc := range []struct {
+		middleware *MiddleWare
+		uid        string
+		code       int
+	}{
+		{allow, "1", http.StatusOK},
+		{allow, "", http.StatusUnauthorized},
+		{allow, "2", http.StatusForbidden},
+		{NewMiddleWare(failingValidator{}, "user:", "uid"), "1", http.StatusInternalServerError},
+	} {
+		w := serve(newTestRouter(tc.middleware, tc.uid), "GET", "/api/users/42")
+		if w.Code != tc.code {
+			t.Error("bad code", w.Code, "want", tc.code)
+		}
+		var msg jwt.UnauthorizedMessage
+		if tc.code != http.StatusOK && json.Unmarshal(w.Body.Bytes(), &msg) != nil {
+			t.Error("bad body", w.Body.String())
+		}
+	}
+}
+
+func TestMiddleWare_DomainResolver(t *testing.T) {
+	mw := NewMiddleWare(policyValidator{
+		"user:1 org-a /api/users/42 GET": true,
+	}, "user:", "uid")
+	mw.DomainResolver = HeaderDomain("X-Org")
+	r := newTestRouter(mw, "1")
+
+	for org, code := range map[string]int{
+		"org-a": http.StatusOK,
+		"org-b": http.StatusForbidden,
+		"":      http.StatusUnauthorized,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/users/42", nil)
+		req.Header.Set("X-Org", org)
+		r.ServeHTTP(w, req)
+		if w.Code != code {
+			t.Error("bad code", org, w.Code, "want", code)
+		}
+	}
+}
+
+func TestMiddleWare_Cache(t *testing.T) {
+	v := policyValidator{"user:1 /api/users/42 GET": true}
+	mw := NewMiddleWare(v, "user:", "uid")
+	mw.Cache = NewDecisionCache(1, time.Minute)
+	r := newTestRouter(mw, "1")
+
+	serve(r, "GET", "/api/users/42")
+	if w := serve(r, "GET", "/api/users/42"); w.Code != http.StatusOK {
+		t.Error("bad code", w.Code)
+	}
+	if hits, misses := mw.Cache.Stats(); hits != 1 || misses != 1 {
+		t.Error("bad stats", hits, misses)
+	}
+
+	// the cached decision outlives the policy until invalidated
+	delete(v, "user:1 /api/users/42 GET")
+	if w := serve(r, "GET", "/api/users/42"); w.Code != http.StatusOK {
+		t.Error("bad code", w.Code)
+	}
+	mw.Invalidate()
+	if w := serve(r, "GET", "/api/users/42"); w.Code != http.StatusForbidden {
+		t.Error("bad code", w.Code)
+	}
+
+	serve(r, "GET", "/api/users/43")
+	if mw.Cache.Len() != 1 {
+		t.Error("cache exceeds its size", mw.Cache.Len())
+	}
+}
+
+func TestMiddleWare_CacheInvalidateDuringEnforce(t *testing.T) {
+	evaluating, invalidated := make(chan struct{}), make(chan struct{})
+	allowed := true
+	mw := NewMiddleWare(ValidatorFunc(func(rvals ...interface{}) (bool, error) {
+		decision := allowed
+		if decision {
+			// the policy is revoked while the old one is being evaluated
+			close(evaluating)
+			<-invalidated
+		}
+		return decision, nil
+	}), "user:", "uid")
+	mw.Cache = NewDecisionCache(10, time.Minute)
+	r := newTestRouter(mw, "1")
+
+	done := make(chan int)
+	go func() {
+		done <- serve(r, "GET", "/api/users/42").Code
+	}()
+	<-evaluating
+	allowed = false
+	mw.Invalidate()
+	close(invalidated)
+	if code := <-done; code != http.StatusOK {
+		t.Error("bad code", code)
+	}
+
+	if mw.Cache.Len() != 0 {
+		t.Error("stale decision cached", mw.Cache.Len())
+	}
+	if w := serve(r, "GET", "/api/users/42"); w.Code != http.StatusForbidden {
+		t.Error("revoked permission allowed", w.Code)
+	}
+}
+
+// explainingValidator explains the decision with the matched key of policyValidator
+type explainingValidator struct {
+	policyValidator
+}
+
+func (v explainingValidator) EnforceEx(rvals ...interface{}) (bool, []string, error) {
+	allowed, err := v.Enforce(rvals...)
+	if allowed {
+		return true, []string{joinValues(rvals)}, err
+	}
+	return false, nil, err
+}
+
+func TestMiddleWare_DryRun(t *testing.T) {
+	var decisions []*Decision
+	mw := NewMiddleWare(explainingValidator{policyValidator{
+		"user:1 /api/users/42 GET": true,
+	}}, "user:", "uid")
+	mw.DryRun = true
+	mw.Logger = DecisionLoggerFunc(func(c *gin.Context, decision *Decision) {
+		decisions = append(decisions, decision)
+	})
+
+	if w := serve(newTestRouter(mw, "1"), "GET", "/api/users/42"); w.Code != http.StatusOK {
+		t.Error("bad code", w.Code)
+	}
+	if w := serve(newTestRouter(mw, "2"), "GET", "/api/users/42"); w.Code != http.StatusOK {
+		t.Error("dry run blocked the request", w.Code)
+	}
+
+	if len(decisions) != 2 || !decisions[0].Allowed || decisions[1].Allowed {
+		t.Fatal("bad decisions", decisions)
+	}
+	if len(decisions[0].Explain) == 0 || !decisions[1].DryRun {
+		t.Error("bad decision", decisions[0])
+	}
+}
+
+func TestMiddleWare_Debug(t *testing.T) {
+	mw := NewMiddleWare(explainingValidator{policyValidator{
+		"user:1 /api/users/42 GET": true,
+		"user:1 /decision GET":     true,
+	}}, "user:", "uid")
+	mw.Debug = true
+
+	r := newTestRouter(mw, "1")
+	r.GET("/decision", func(c *gin.Context) {
+		decision, ok := GetDecision(c)
+		if !ok || !decision.Allowed {
+			t.Error("bad decision", decision)
+		}
+	})
+
+	w := serve(r, "GET", "/api/users/42")
+	if w.Header().Get(MatchedRuleHeader) != "user:1 /api/users/42 GET" {
+		t.Error("bad header", w.Header())
+	}
+	serve(r, "GET", "/decision")
+	w = serve(r, "GET", "/api/users/43")
+	if w.Code != http.StatusForbidden || !strings.HasPrefix(w.Header().Get(DecisionHeader), "deny") {
+		t.Error("bad header", w.Code, w.Header())
+	}
+}
+
+func TestMiddleWare_Routes(t *testing.T) {
+	mw := NewMiddleWare(policyValidator{
+		"user:1 users read":   true,
+		"user:1 orders write": true,
+	}, "user:", "uid")
+	mw.Routes = NewRouteRegistry()
+	mw.DenyUndeclared = true
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if len(c.Query("anonymous")) == 0 {
+			c.Set("uid", "1")
+		}
+	})
+	api := r.Group("/api")
+	api.Use(mw.Build())
+	ok := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	}
+	mw.Routes.Handle(api, "GET", "/users/:id", "users", "read", ok)
+	mw.Routes.Handle(api, "PUT", "/users/:id", "users", "write", ok)
+	api.GET("/undeclared", ok)
+	r.PUT("/orders/:id", mw.Require("orders", "write"), ok)
+	r.DELETE("/orders/:id", mw.Require("orders", "delete"), ok)
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/api/users/42", http.StatusOK},
+		{"PUT", "/api/users/42", http.StatusForbidden},
+		{"GET", "/api/undeclared", http.StatusForbidden},
+		{"GET", "/api/undeclared?anonymous=1", http.StatusUnauthorized},
+		{"GET", "/api/users/42?anonymous=1", http.StatusUnauthorized},
+		{"PUT", "/orders/42", http.StatusOK},
+		{"DELETE", "/orders/42", http.StatusForbidden},
+	} {
+		if w := serve(r, tc.method, tc.path); w.Code != tc.code {
+			t.Error("bad code", tc.method, tc.path, w.Code, "want", tc.code)
+		}
+	}
+}
+
+func TestMiddleWare_Coverage(t *testing.T) {
+	mw := NewMiddleWare(policyValidator{
+		"user:1 /api/users/:id GET": true,
+	}, "user:", "uid")
+	mw.ObjectResolver = FullPath
+
+	r := gin.New()
+	ok := func(c *gin.Context) {}
+	r.GET("/api/users/:id", ok)
+	r.DELETE("/api/users/:id", ok)
+	r.GET("/ping", ok)
+
+	reports, err := mw.Coverage(RoutesWithPrefix(r.Routes(), "/api"), "user:1", "user:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatal("bad reports", reports)
+	}
+	for _, report := range reports {
+		switch report.Method {
+		case "GET":
+			if report.Unreachable || len(report.AllowedSubjects) != 1 || report.AllowedSubjects[0] != "user:1" {
+				t.Error("bad report", report)
+			}
+		case "DELETE":
+			if !report.Unreachable {
+				t.Error("bad report", report)
+			}
+		}
+	}
+
+	var b strings.Builder
+	if err = WritePolicySkeleton(&b, reports, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "\np, admin, /api/users/:id, DELETE\n") &&
+		!strings.HasPrefix(b.String(), "p, admin, /api/users/:id, DELETE\n") {
+		t.Error("bad skeleton", b.String())
+	}
+}
+
+func TestMiddleWare_CoverageUndeclared(t *testing.T) {
+	mw := NewMiddleWare(Static(true), "user:", "uid")
+	mw.Routes = NewRouteRegistry()
+	mw.DenyUndeclared = true
+
+	r := gin.New()
+	ok := func(c *gin.Context) {}
+	mw.Routes.Handle(&r.RouterGroup, "GET", "/api/users/:id", "users", "read", ok)
+	r.DELETE("/api/users/:id", ok)
+
+	reports, err := mw.Coverage(r.Routes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, report := range reports {
+		switch report.Method {
+		case "GET":
+			if !report.Declared || report.Undeclared || !report.Public {
+				t.Error("bad report", report)
+			}
+		case "DELETE":
+			// the validator allows everything, but the route is never enforced
+			if !report.Undeclared || !report.Unreachable || report.Public {
+				t.Error("bad report", report)
+			}
+		}
+	}
+
+	var b strings.Builder
+	if err = WritePolicySkeleton(&b, reports, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "# DELETE /api/users/:id is denied as undeclared") {
+		t.Error("bad skeleton", b.String())
+	}
+}
+
+func TestMiddleWare_CoverageCasbin(t *testing.T) {
+	m, err := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && regexMatch(r.obj, p.obj) && regexMatch(r.act, p.act)
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := casbin.NewEnforcer(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.AddPolicy("admin", "^/api/users/.*$", "GET"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.AddGroupingPolicy("user:1", "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	mw := NewMiddleWare(e, "user:", "uid")
+	mw.ObjectResolver = FullPath
+	reports, err := mw.Coverage(gin.RoutesInfo{
+		{Method: "GET", Path: "/api/users/:id"},
+		{Method: "DELETE", Path: "/api/users/:id"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reports[0].Unreachable || strings.Join(reports[0].AllowedSubjects, " ") != "admin" {
+		t.Error("bad report", reports[0])
+	}
+	if !reports[1].Unreachable {
+		t.Error("bad report", reports[1])
+	}
+}
+
+// ownerValidator allows the owners only
+type ownerValidator struct{}
+
+func (ownerValidator) Enforce(rvals ...interface{}) (bool, error) {
+	attrs, ok := rvals[len(rvals)-1].(*Attributes)
+	if !ok {
+		return false, errors.New("missing attributes")
+	}
+	return attrs.Owner && attrs.Query["q"] == "x" && !attrs.Time.IsZero(), nil
+}
+
+func TestMiddleWare_ABAC(t *testing.T) {
+	mw := NewMiddleWare(ownerValidator{}, "user:", "uid")
+	mw.ABAC = true
+	mw.Attributors = []Attributor{OwnerParam("id", ContextKey("", "uid"))}
+	mw.Debug = true
+	r := newTestRouter(mw, "42")
+
+	if w := serve(r, "GET", "/api/users/42?q=x"); w.Code != http.StatusOK {
+		t.Error("bad code", w.Code)
+	} else if header := w.Header().Get(DecisionHeader); strings.Contains(header, "0x") ||
+		!strings.Contains(header, "Subject:user:42 ClientIP:") ||
+		!strings.Contains(header, "Owner:true Params:map[id:42] Query:map[q:x]") {
+		t.Error("bad decision header", header)
+	}
+	if w := serve(r, "GET", "/api/users/43?q=x"); w.Code != http.StatusForbidden {
+		t.Error("bad code", w.Code)
+	}
+}
+
+func TestMiddleWare_ClientIP(t *testing.T) {
+	var clientIP string
+	mw := NewMiddleWare(ValidatorFunc(func(rvals ...interface{}) (bool, error) {
+		clientIP = rvals[len(rvals)-1].(*Attributes).ClientIP
+		return true, nil
+	}), "user:", "uid")
+	mw.ABAC = true
+	r := newTestRouter(mw, "42")
+
+	request := func() {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/users/42", nil)
+		req.RemoteAddr = "203.0.113.7:4321"
+		req.Header.Set("X-Forwarded-For", "10.0.0.1")
+		req.Header.Set("X-Real-Ip", "10.0.0.1")
+		r.ServeHTTP(w, req)
+	}
+
+	// the forged headers are ignored by default
+	if request(); clientIP != "203.0.113.7" {
+		t.Error("bad client ip", clientIP)
+	}
+	mw.IPResolver = ForwardedIP
+	if request(); clientIP != "10.0.0.1" {
+		t.Error("bad forwarded ip", clientIP)
+	}
+}
+
+func TestCombinators(t *testing.T) {
+	policy := policyValidator{"user:1 /a GET": true}
+	failing := failingValidator{}
+	for i, tc := range []struct {
+		v       Validator
+		allowed bool
+		err     bool
+	}{
+		{Static(true), true, false},
+		{Not(Static(true)), false, false},
+		{AnyOf(Static(false), policy), true, false},
+		{AnyOf(failing, policy), true, false},
+		{AnyOf(failing, Static(false)), false, true},
+		{AllOf(policy, Static(true)), true, false},
+		{AllOf(policy, Not(policy)), false, false},
+		{AllOf(policy, failing), false, true},
+		{AllOf(), false, false},
+		{AnyOf(), false, false},
+		{Not(failing), false, true},
+	} {
+		allowed, err := tc.v.Enforce("user:1", "/a", "GET")
+		if allowed != tc.allowed || (err != nil) != tc.err {
+			t.Error("bad decision", i, allowed, err)
+		}
+	}
+}
+
+func TestMemoryValidator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "privileger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "policy.yaml")
+	if err = ioutil.WriteFile(filename, []byte(`
+roles:
+  user:1: [admin]
+  user:2: [viewer]
+  admin: [viewer]
+rules:
+  - subject: viewer
+    object: /api/users/*
+    actions: [GET, HEAD]
+  - subject: admin
+    object: /api/users/:id
+    actions: [PUT, DELETE]
+  - subject: admin
+    object: /api/admin/**
+    actions: ["*"]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := LoadMemoryValidator(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		sub, obj, act string
+		allowed       bool
+	}{
+		{"user:2", "/api/users/42", "GET", true},
+		{"user:2", "/api/users/42", "PUT", false},
+		{"user:2", "/api/users/42/posts", "GET", false},
+		{"user:1", "/api/users/42", "get", true},
+		{"user:1", "/api/users/:id", "DELETE", true},
+		{"user:1", "/api/admin/a/b/c", "POST", true},
+		{"user:2", "/api/admin/a", "GET", false},
+		{"user:3", "/api/users/42", "GET", false},
+	} {
+		allowed, err := v.Enforce(tc.sub, tc.obj, tc.act)
+		if err != nil || allowed != tc.allowed {
+			t.Error("bad decision", tc, allowed, err)
+		}
+	}
+
+	if _, err = v.Enforce("user:1", "org", "/api/users/42", "GET"); err != ErrUnsupportedRequest {
+		t.Error("domain request accepted", err)
+	}
+}
+
+// batchValidator counts the batches it evaluates
+type batchValidator struct {
+	policyValidator
+	batches int
+}
+
+func (v *batchValidator) BatchEnforce(requests [][]interface{}) ([]bool, error) {
+	v.batches++
+	results := make([]bool, len(requests))
+	for i, rvals := range requests {
+		results[i], _ = v.Enforce(rvals...)
+	}
+	return results, nil
+}
+
+func TestMiddleWare_PermissionsHandler(t *testing.T) {
+	v := &batchValidator{policyValidator: policyValidator{
+		"user:1 /api/permissions POST": true,
+		"user:1 orders read":           true,
+	}}
+	mw := NewMiddleWare(v, "user:", "uid")
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("uid", "1")
+	results, err := mw.CheckMany(c, []Permission{{"orders", "read"}, {"orders", "write"}})
+	if err != nil || len(results) != 2 || !results[0] || results[1] || v.batches != 1 {
+		t.Fatal("bad batch", results, err, v.batches)
+	}
+
+	mw.Cache = NewDecisionCache(16, time.Minute)
+	if results, err = mw.CheckMany(c, []Permission{{"orders", "read"}}); err != nil || !results[0] || v.batches != 1 {
+		t.Fatal("batch bypassed the cache", results, err, v.batches)
+	}
+
+	r := newTestRouter(mw, "1")
+	r.POST("/api/permissions", mw.PermissionsHandler())
+	for _, tc := range []struct {
+		body   string
+		status int
+		resp   string
+	}{
+		{`{"permissions":[{"object":"orders","action":"read"},{"object":"orders","action":"write"}]}`,
+			http.StatusOK, `{"permissions":{"orders":{"read":true,"write":false}}}`},
+		{`{"permissions":[{"object":"orders"}]}`, http.StatusBadRequest, ""},
+		{`{}`, http.StatusBadRequest, ""},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/permissions", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		if w.Code != tc.status || (len(tc.resp) != 0 && w.Body.String() != tc.resp) {
+			t.Error("bad response", tc.body, w.Code, w.Body.String())
+		}
+	}
+}
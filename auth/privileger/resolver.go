@@ -0,0 +1,73 @@
+package privileger
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ObjectResolver return the object of the request to enforce on
+type ObjectResolver func(c *gin.Context) string
+
+// ActionResolver return the action of the request to enforce on
+type ActionResolver func(c *gin.Context) string
+
+// IPResolver return the client IP of the request
+type IPResolver func(c *gin.Context) string
+
+// RemoteIP is the default IPResolver, it uses the address of the peer and
+// ignores the forwarded headers which could be forged by any client
+func RemoteIP(c *gin.Context) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+	if err != nil {
+		return strings.TrimSpace(c.Request.RemoteAddr)
+	}
+	return host
+}
+
+// ForwardedIP trusts X-Forwarded-For and X-Real-Ip by gin.Context.ClientIP,
+// use it only if the service is reachable through the trusted proxies only
+func ForwardedIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// RequestPath is the default ObjectResolver, e.g. /api/users/42
+func RequestPath(c *gin.Context) string {
+	return c.Request.URL.Path
+}
+
+// FullPath uses the matched route template as the object, e.g. /api/users/:id,
+// so that one policy covers every id. The request path is used if no route matched
+func FullPath(c *gin.Context) string {
+	if path := c.FullPath(); len(path) != 0 {
+		return path
+	}
+	return c.Request.URL.Path
+}
+
+// RequestMethod is the default ActionResolver, e.g. GET
+func RequestMethod(c *gin.Context) string {
+	return c.Request.Method
+}
+
+// MethodActions return an ActionResolver mapping the request method to an action,
+// the lower-cased method is used if it is not in the mapping
+func MethodActions(mapping map[string]string) ActionResolver {
+	return func(c *gin.Context) string {
+		if action, ok := mapping[c.Request.Method]; ok {
+			return action
+		}
+		return strings.ToLower(c.Request.Method)
+	}
+}
+
+// CRUDAction maps the request method to one of create, read, update and delete
+var CRUDAction = MethodActions(map[string]string{
+	"GET":    "read",
+	"HEAD":   "read",
+	"POST":   "create",
+	"PUT":    "update",
+	"PATCH":  "update",
+	"DELETE": "delete",
+})
@@ -0,0 +1,64 @@
+package privileger
+
+import (
+	"path"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permission is a pair of object and action to enforce on
+type Permission struct {
+	Object string `json:"object" binding:"required"`
+	Action string `json:"action" binding:"required"`
+}
+
+// RouteRegistry maps the route templates to the permissions they require
+type RouteRegistry struct {
+	mutex  sync.RWMutex
+	routes map[string]Permission
+}
+
+// NewRouteRegistry return an empty RouteRegistry
+func NewRouteRegistry() *RouteRegistry {
+	return &RouteRegistry{routes: make(map[string]Permission)}
+}
+
+// Declare the permission of the route, fullPath is the route template
+// as returned by gin.Context.FullPath, e.g. /api/users/:id
+func (registry *RouteRegistry) Declare(method, fullPath, object, action string) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.routes[method+" "+fullPath] = Permission{Object: object, Action: action}
+}
+
+// Lookup return the permission of the route
+func (registry *RouteRegistry) Lookup(method, fullPath string) (Permission, bool) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	permission, ok := registry.routes[method+" "+fullPath]
+	return permission, ok
+}
+
+// Handle registers the route on the group and declares its permission
+// right next to it, e.g.
+//
+//	routes.Handle(authRouter, "GET", "/policy", "policy", "read", authService.GetPolicy)
+func (registry *RouteRegistry) Handle(
+	group *gin.RouterGroup, method, relativePath, object, action string, handlers ...gin.HandlerFunc,
+) gin.IRoutes {
+	registry.Declare(method, joinPaths(group.BasePath(), relativePath), object, action)
+	return group.Handle(method, relativePath, handlers...)
+}
+
+// joinPaths joins the paths in the same way as gin.RouterGroup
+func joinPaths(absolutePath, relativePath string) string {
+	if len(relativePath) == 0 {
+		return absolutePath
+	}
+	finalPath := path.Join(absolutePath, relativePath)
+	if relativePath[len(relativePath)-1] == '/' && finalPath[len(finalPath)-1] != '/' {
+		return finalPath + "/"
+	}
+	return finalPath
+}
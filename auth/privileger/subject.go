@@ -0,0 +1,102 @@
+package privileger
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/Myriad-Dreamin/gin-middleware/auth/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// SubjectResolver return the subject of the request to enforce on
+type SubjectResolver func(c *gin.Context) (string, error)
+
+// ContextKey reads the subject from the context value of key in any type,
+// e.g. ContextKey("user:", "uid") gives "user:42" for an int 42
+func ContextKey(prefix, key string) SubjectResolver {
+	return func(c *gin.Context) (string, error) {
+		value, ok := c.Get(key)
+		if !ok {
+			return "", ErrMissingSubject
+		}
+		return formatSubject(prefix, value)
+	}
+}
+
+// ClaimsSubject reads the subject from the sub claim set by jwt.Middleware
+func ClaimsSubject(prefix string) SubjectResolver {
+	return func(c *gin.Context) (string, error) {
+		claims, err := contextClaims(c)
+		if err != nil {
+			return "", err
+		}
+		return formatSubject(prefix, claims.Subject)
+	}
+}
+
+// ClaimsField reads the subject from the custom field of the claims set by
+// jwt.Middleware, the path walks through struct fields and map keys,
+// e.g. ClaimsField("user:", "UID") for a CustomField of type *struct{ UID int }
+func ClaimsField(prefix string, path ...string) SubjectResolver {
+	return func(c *gin.Context) (string, error) {
+		claims, err := contextClaims(c)
+		if err != nil {
+			return "", err
+		}
+		value, ok := lookupField(claims.CustomField, path)
+		if !ok {
+			return "", ErrMissingSubject
+		}
+		return formatSubject(prefix, value)
+	}
+}
+
+func contextClaims(c *gin.Context) (*jwt.CustomClaims, error) {
+	value, _ := c.Get(jwt.ClaimsKey)
+	if claims, ok := value.(*jwt.CustomClaims); ok && claims != nil {
+		return claims, nil
+	}
+	return nil, ErrMissingClaims
+}
+
+func formatSubject(prefix string, value interface{}) (string, error) {
+	s := fmt.Sprint(value)
+	if value == nil || len(s) == 0 {
+		return "", ErrMissingSubject
+	}
+	return prefix + s, nil
+}
+
+// lookupField walks through the struct fields and the map keys of value
+func lookupField(value interface{}, path []string) (interface{}, bool) {
+	rv := reflect.ValueOf(value)
+	for _, name := range path {
+		rv = indirect(rv)
+		switch rv.Kind() {
+		case reflect.Struct:
+			rv = rv.FieldByName(name)
+		case reflect.Map:
+			if rv.Type().Key().Kind() != reflect.String {
+				return nil, false
+			}
+			rv = rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		default:
+			return nil, false
+		}
+	}
+	rv = indirect(rv)
+	if !rv.IsValid() || !rv.CanInterface() {
+		return nil, false
+	}
+	return rv.Interface(), true
+}
+
+func indirect(rv reflect.Value) reflect.Value {
+	for rv.IsValid() && (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
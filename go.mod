@@ -5,10 +5,12 @@ go 1.12
 require (
 	github.com/Myriad-Dreamin/core-oj v1.0.0
 	github.com/casbin/casbin v1.9.1
-	github.com/casbin/casbin/v2 v2.0.1
-	github.com/casbin/xorm-adapter v0.0.0-20190806085643-0629743c2857
-	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/casbin/casbin/v2 v2.105.0
+	github.com/casbin/govaluate v1.3.0
 	github.com/gin-gonic/gin v1.5.0
 	github.com/go-sql-driver/mysql v1.4.1
 	github.com/go-xorm/xorm v0.7.6
+	github.com/golang-jwt/jwt/v4 v4.5.2
+	golang.org/x/crypto v0.0.0-20220214200702-86341886e292
+	gopkg.in/yaml.v2 v2.2.2
 )
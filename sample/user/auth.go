@@ -4,19 +4,25 @@ import (
 	"net/http"
 
 	"github.com/Myriad-Dreamin/core-oj/log"
-	rbac "github.com/Myriad-Dreamin/gin-middleware/sample/user/rbac"
+	policy "github.com/Myriad-Dreamin/gin-middleware/auth/policy"
+	privileger "github.com/Myriad-Dreamin/gin-middleware/auth/privileger"
 	"github.com/gin-gonic/gin"
 )
 
 type AuthService struct {
 	logger   log.TendermintLogger
 	codePath string
+	policy   *policy.Manager
+	actor    privileger.SubjectResolver
 }
 
-// NewAuthService return a pointer of AuthService
-func NewAuthService(logger log.TendermintLogger) *AuthService {
+// NewAuthService return a pointer of AuthService, the changes of policy are
+// audited on behalf of the actor
+func NewAuthService(logger log.TendermintLogger, mgr *policy.Manager, actor privileger.SubjectResolver) *AuthService {
 	return &AuthService{
 		logger: logger,
+		policy: mgr,
+		actor:  actor,
 	}
 }
 
@@ -36,7 +42,10 @@ func (as *AuthService) AddPolicy(c *gin.Context) {
 		return
 	}
 
-	added, err := rbac.AddPolicy(req.Subject, req.Object, req.Action)
+	actor, _ := as.actor(c)
+	added, err := as.policy.Audited(actor, "add policy", func() (bool, error) {
+		return as.policy.AddPolicy(req.Subject, req.Object, req.Action)
+	})
 
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -68,7 +77,10 @@ func (as *AuthService) AddGroupingPolicy(c *gin.Context) {
 		return
 	}
 
-	added, err := rbac.AddGroupingPolicy(req.Subject, req.Group)
+	actor, _ := as.actor(c)
+	added, err := as.policy.Audited(actor, "add grouping policy", func() (bool, error) {
+		return as.policy.AddGroupingPolicy(req.Subject, req.Group)
+	})
 
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -86,15 +98,31 @@ func (as *AuthService) AddGroupingPolicy(c *gin.Context) {
 }
 
 func (as *AuthService) GetPolicy(c *gin.Context) {
+	rules, err := as.policy.GetPolicy()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":  CodeSelectError,
+			"error": err.Error(),
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"code":   CodeOK,
-		"policy": rbac.GetPolicy(),
+		"policy": rules,
 	})
 }
 
 func (as *AuthService) GetGroupingPolicy(c *gin.Context) {
+	rules, err := as.policy.GetGroupingPolicy()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":  CodeSelectError,
+			"error": err.Error(),
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"code":   CodeOK,
-		"policy": rbac.GetGroupingPolicy(),
+		"policy": rules,
 	})
 }
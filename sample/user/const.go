@@ -9,4 +9,6 @@ const (
 	CodeNotFound
 
 	CodeAuthGenerateTokenError
+
+	CodeSelectError
 )
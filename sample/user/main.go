@@ -3,10 +3,11 @@ package main
 import (
 	"fmt"
 	"os"
-	"strconv"
+	"time"
 
 	"github.com/Myriad-Dreamin/core-oj/log"
 	jwt "github.com/Myriad-Dreamin/gin-middleware/auth/jwt"
+	policy "github.com/Myriad-Dreamin/gin-middleware/auth/policy"
 	privileger "github.com/Myriad-Dreamin/gin-middleware/auth/privileger"
 	morm "github.com/Myriad-Dreamin/gin-middleware/sample/user/orm"
 	rbac "github.com/Myriad-Dreamin/gin-middleware/sample/user/rbac"
@@ -18,6 +19,7 @@ import (
 type Server struct {
 	engine *xorm.Engine
 	logger log.TendermintLogger
+	policy *policy.Manager
 }
 
 func NewServer() (srv *Server, err error) {
@@ -40,7 +42,7 @@ func (srv *Server) prepareDatabase(driver, connection string) error {
 		return err
 	}
 
-	err = rbac.Init(srv.engine)
+	srv.policy, err = rbac.New(srv.engine)
 	if err != nil {
 		srv.logger.Error("prepare failed", "error", err)
 		return err
@@ -67,14 +69,20 @@ func (srv *Server) Serve(port string) error {
 		return err
 	}
 
-	x := rbac.GetEnforcer()
+	reloader, err := rbac.NewReloader(srv.engine, srv.policy)
+	if err != nil {
+		return err
+	}
+	reloader.OnError = func(err error) {
+		srv.logger.Error("reload policy failed", "error", err)
+	}
+	stopReload := reloader.Watch(10 * time.Second)
+	defer stopReload()
 	jwtmw := jwt.NewMiddleWare(func() *jwt.CustomClaims {
 		var cc = new(jwt.CustomClaims)
 		cc.CustomField = &CustomField{}
 		return cc
 	}, func(c *gin.Context, cc *jwt.CustomClaims) error {
-		fmt.Println(cc.CustomField.(*CustomField).UID)
-		c.Set("uid", strconv.Itoa(cc.CustomField.(*CustomField).UID))
 		return nil
 	})
 
@@ -102,7 +110,11 @@ func (srv *Server) Serve(port string) error {
 	// _ = authmw
 	apiRouter := r.Group("/api")
 	apiRouter.Use(jwtmw.Build())
-	authmw := privileger.NewMiddleWare(&x, "user:", "uid")
+	authmw := privileger.NewMiddleWareWithResolver(srv.policy, privileger.ClaimsField("user:", "UID"))
+	authmw.Cache = privileger.NewDecisionCache(4096, time.Minute)
+	srv.policy.OnChange = authmw.Invalidate
+	routes := privileger.NewRouteRegistry()
+	authmw.Routes = routes
 	apiRouter.Use(authmw.Build())
 	{
 		apiRouter.GET("/authv2", func(c *gin.Context) {
@@ -122,15 +134,18 @@ func (srv *Server) Serve(port string) error {
 
 		authRouter := apiRouter.Group("/auth")
 		{
-			var authService = NewAuthService(srv.logger)
-			authRouter.GET("/policy", authService.GetPolicy)
-			authRouter.PUT("/policy", authService.AddPolicy)
-			authRouter.GET("/group/policy", authService.GetGroupingPolicy)
-			authRouter.PUT("/group/policy", authService.AddGroupingPolicy)
+			var authService = NewAuthService(srv.logger, srv.policy, authmw.SubjectResolver)
+			routes.Handle(authRouter, "GET", "/policy", "policy", "read", authService.GetPolicy)
+			routes.Handle(authRouter, "PUT", "/policy", "policy", "write", authService.AddPolicy)
+			routes.Handle(authRouter, "GET", "/group/policy", "group", "read", authService.GetGroupingPolicy)
+			routes.Handle(authRouter, "PUT", "/group/policy", "group", "write", authService.AddGroupingPolicy)
 
 		}
 	}
 
+	// the policy administration API enforces the permissions of its routes itself
+	policy.RegisterPolicyRoutes(r.Group("/admin/policy", jwtmw.Build()), srv.policy, authmw)
+
 	return r.Run(port)
 }
 
@@ -0,0 +1,209 @@
+// Command policyctl exports, imports and lints the policy in the database of the sample,
+// run it in sample/user where rbac.conf is, e.g.
+//
+//	policyctl export -o policy.csv
+//	policyctl import -dry-run policy.csv
+//	policyctl import policy.csv
+//	policyctl lint policy.csv
+//
+// The database is opened by rbac.Open without migrating it, so that export,
+// import -dry-run and lint never change it.
+//
+// lint reads the policy file without connecting to the database if it is given,
+// and exits with 1 if there are errors so that it can run in the CI. Linting the
+// database does not bump the policy version, so the services do not reload
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	policy "github.com/Myriad-Dreamin/gin-middleware/auth/policy"
+	rbac "github.com/Myriad-Dreamin/gin-middleware/sample/user/rbac"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-xorm/xorm"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage:
+  policyctl [-driver driver] [-dsn dsn] export [-format csv|json] [-o file]
+  policyctl [-driver driver] [-dsn dsn] import [-format csv|json] [-dry-run] file
+  policyctl [-driver driver] [-dsn dsn] lint [-model rbac.conf] [-strict] [file]
+`)
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	driver := flag.String("driver", "mysql", "database driver")
+	dsn := flag.String("dsn", "coreoj-admin:123456@tcp(127.0.0.1:3306)/coreoj?charset=utf8", "database source")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+	}
+
+	connect := func() (*policy.Manager, error) {
+		x, err := xorm.NewEngine(*driver, *dsn)
+		if err != nil {
+			return nil, err
+		}
+		return rbac.Open(x)
+	}
+
+	var err error
+	switch flag.Arg(0) {
+	case "export":
+		err = withManager(connect, flag.Args()[1:], export)
+	case "import":
+		err = withManager(connect, flag.Args()[1:], importPolicy)
+	case "lint":
+		err = lint(connect, flag.Args()[1:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func withManager(connect func() (*policy.Manager, error), args []string,
+	command func(mgr *policy.Manager, args []string) error) error {
+	mgr, err := connect()
+	if err != nil {
+		return err
+	}
+	return command(mgr, args)
+}
+
+func export(mgr *policy.Manager, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "", "csv or json, guessed by the extension of the output by default")
+	output := flags.String("o", "", "output file, stdout by default")
+	_ = flags.Parse(args)
+
+	snapshot, err := mgr.Export()
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if len(*output) != 0 {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if guessFormat(*format, *output) == "json" {
+		return policy.WriteJSON(w, snapshot)
+	}
+	return policy.WriteCSV(w, snapshot)
+}
+
+func importPolicy(mgr *policy.Manager, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "csv or json, guessed by the extension of the input by default")
+	dryRun := flags.Bool("dry-run", false, "print the diff without applying it")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var snapshot policy.Snapshot
+	if guessFormat(*format, flags.Arg(0)) == "json" {
+		snapshot, err = policy.ReadJSON(f)
+	} else {
+		snapshot, err = policy.ReadCSV(f)
+	}
+	if err != nil {
+		return err
+	}
+
+	diff, err := mgr.Diff(snapshot)
+	if err != nil {
+		return err
+	}
+	if diff.Empty() {
+		fmt.Println("policy is up to date")
+		return nil
+	}
+	fmt.Print(diff)
+	if *dryRun {
+		return nil
+	}
+	// the changes made by the command are audited on behalf of the system user
+	_, err = mgr.Audited("policyctl:"+os.Getenv("USER"), "import "+flags.Arg(0), func() (bool, error) {
+		diff, err := mgr.Apply(snapshot)
+		return diff != nil && !diff.Empty(), err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("policy applied")
+	return nil
+}
+
+// errLintFailed is returned by lint when the policy has errors, or warnings in strict mode
+var errLintFailed = errors.New("policy lint failed")
+
+func lint(connect func() (*policy.Manager, error), args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	modelPath := flags.String("model", "rbac.conf", "model file of the policy file")
+	strict := flags.Bool("strict", false, "fail on the warnings too")
+	_ = flags.Parse(args)
+	if flags.NArg() > 1 {
+		usage()
+	}
+
+	var issues []policy.Issue
+	var err error
+	if flags.NArg() == 1 {
+		issues, err = policy.LintFiles(*modelPath, flags.Arg(0), nil)
+	} else {
+		// the policy is read only, the other instances are not asked to reload it
+		var mgr *policy.Manager
+		if mgr, err = connect(); err == nil {
+			issues, err = mgr.Lint()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if policy.HasErrors(issues) || (*strict && len(issues) != 0) {
+		return errLintFailed
+	}
+	if len(issues) == 0 {
+		fmt.Println("policy is fine")
+	}
+	return nil
+}
+
+func guessFormat(format, filename string) string {
+	if len(format) != 0 {
+		return format
+	}
+	if filepath.Ext(filename) == ".json" {
+		return "json"
+	}
+	return "csv"
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
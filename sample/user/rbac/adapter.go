@@ -0,0 +1,160 @@
+package rbac
+
+import (
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/go-xorm/xorm"
+)
+
+// CasbinRule is a row of the policy, the table is compatible with xormadapter
+type CasbinRule struct {
+	PType string `xorm:"varchar(100) index"`
+	V0    string `xorm:"varchar(100) index"`
+	V1    string `xorm:"varchar(100) index"`
+	V2    string `xorm:"varchar(100) index"`
+	V3    string `xorm:"varchar(100) index"`
+	V4    string `xorm:"varchar(100) index"`
+	V5    string `xorm:"varchar(100) index"`
+}
+
+// TableName return the table name
+func (*CasbinRule) TableName() string {
+	return "casbin_rule"
+}
+
+// Adapter is the persist.BatchAdapter of the policy in the casbin_rule table, it saves
+// the whole policy and the batches of rules in transactions so that a failed save
+// leaves the policy in the database intact instead of a part of the rules. It never
+// changes the schema, New creates the table
+type Adapter struct {
+	x *xorm.Engine
+}
+
+// NewAdapter return the adapter of the policy in the casbin_rule table
+func NewAdapter(x *xorm.Engine) *Adapter {
+	return &Adapter{x: x}
+}
+
+// LoadPolicy loads the rules in the table into the model
+func (a *Adapter) LoadPolicy(m model.Model) error {
+	var rules []*CasbinRule
+	if err := a.x.Find(&rules); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if err := persist.LoadPolicyArray(rule.line(), m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SavePolicy replaces the rules in the table by the policy of the model in a transaction
+func (a *Adapter) SavePolicy(m model.Model) error {
+	var rules []*CasbinRule
+	for _, sec := range []string{"p", "g"} {
+		for ptype, assertion := range m[sec] {
+			for _, rule := range assertion.Policy {
+				rules = append(rules, newCasbinRule(ptype, 0, rule))
+			}
+		}
+	}
+
+	return a.transact(func(session *xorm.Session) error {
+		if _, err := session.Exec("DELETE FROM casbin_rule"); err != nil {
+			return err
+		}
+		if len(rules) != 0 {
+			if _, err := session.Insert(&rules); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddPolicy adds a rule to the table
+func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
+	_, err := a.x.Insert(newCasbinRule(ptype, 0, rule))
+	return err
+}
+
+// RemovePolicy removes a rule from the table
+func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	_, err := a.x.Delete(newCasbinRule(ptype, 0, rule))
+	return err
+}
+
+// RemoveFilteredPolicy removes the rules matching the field values from fieldIndex,
+// the empty values match any value
+func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	_, err := a.x.Delete(newCasbinRule(ptype, fieldIndex, fieldValues))
+	return err
+}
+
+// AddPolicies adds the rules to the table in a transaction, none of them is added on failure
+func (a *Adapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	return a.transact(func(session *xorm.Session) error {
+		for _, rule := range rules {
+			if _, err := session.Insert(newCasbinRule(ptype, 0, rule)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RemovePolicies removes the rules from the table in a transaction, none of them is removed on failure
+func (a *Adapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	return a.transact(func(session *xorm.Session) error {
+		for _, rule := range rules {
+			if _, err := session.Delete(newCasbinRule(ptype, 0, rule)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// transact runs f in a transaction, it is rolled back if f fails
+func (a *Adapter) transact(f func(session *xorm.Session) error) error {
+	session := a.x.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	if err := f(session); err != nil {
+		_ = session.Rollback()
+		return err
+	}
+	return session.Commit()
+}
+
+// newCasbinRule return the row of the fields from fieldIndex, xorm matches
+// the non-empty fields only when deleting
+func newCasbinRule(ptype string, fieldIndex int, fields []string) *CasbinRule {
+	rule := &CasbinRule{PType: ptype}
+	values := rule.values()
+	for i, field := range fields {
+		if fieldIndex+i < len(values) {
+			*values[fieldIndex+i] = field
+		}
+	}
+	return rule
+}
+
+func (rule *CasbinRule) values() []*string {
+	return []*string{&rule.V0, &rule.V1, &rule.V2, &rule.V3, &rule.V4, &rule.V5}
+}
+
+// line return the ptype and the fields without the trailing empty ones
+func (rule *CasbinRule) line() []string {
+	line := []string{rule.PType}
+	for _, value := range rule.values() {
+		line = append(line, *value)
+	}
+	for len(line) > 1 && len(line[len(line)-1]) == 0 {
+		line = line[:len(line)-1]
+	}
+	return line
+}
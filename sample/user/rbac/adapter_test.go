@@ -0,0 +1,6 @@
+package rbac
+
+import "github.com/casbin/casbin/v2/persist"
+
+// the manager imports the rules at once through AddPolicies
+var _ persist.BatchAdapter = (*Adapter)(nil)
@@ -0,0 +1,112 @@
+package rbac
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Myriad-Dreamin/gin-middleware/auth/policy"
+	"github.com/go-xorm/xorm"
+)
+
+// PolicyAudit is a row of the audit trail of the policy, the snapshots are in json
+type PolicyAudit struct {
+	ID        int64     `xorm:"not null pk autoincr 'id'"`
+	Actor     string    `xorm:"not null index 'actor'"`
+	Action    string    `xorm:"text 'action'"`
+	Before    string    `xorm:"longtext 'policy_before'"`
+	After     string    `xorm:"longtext 'policy_after'"`
+	CreatedAt time.Time `xorm:"not null 'created_at'"`
+}
+
+// TableName return the table name
+func (*PolicyAudit) TableName() string {
+	return "casbin_policy_audit"
+}
+
+// AuditStore is a policy.AuditStore in the casbin_policy_audit table
+type AuditStore struct {
+	x *xorm.Engine
+}
+
+// NewAuditStore return the store with the table created
+func NewAuditStore(x *xorm.Engine) (*AuditStore, error) {
+	if err := x.Sync2(new(PolicyAudit)); err != nil {
+		return nil, err
+	}
+	return &AuditStore{x: x}, nil
+}
+
+// AddRecord implements policy.AuditStore
+func (store *AuditStore) AddRecord(record *policy.AuditRecord) error {
+	before, err := json.Marshal(record.Before)
+	if err != nil {
+		return err
+	}
+	after, err := json.Marshal(record.After)
+	if err != nil {
+		return err
+	}
+	row := &PolicyAudit{
+		Actor:     record.Actor,
+		Action:    record.Action,
+		Before:    string(before),
+		After:     string(after),
+		CreatedAt: record.Time,
+	}
+	if _, err = store.x.Insert(row); err != nil {
+		return err
+	}
+	record.ID = row.ID
+	return nil
+}
+
+// ListRecords implements policy.AuditStore
+func (store *AuditStore) ListRecords(offset, limit int) ([]*policy.AuditRecord, int64, error) {
+	total, err := store.x.Count(new(PolicyAudit))
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	var rows []PolicyAudit
+	if err = store.x.Desc("id").Limit(limit, offset).Find(&rows); err != nil {
+		return nil, 0, err
+	}
+	records := make([]*policy.AuditRecord, len(rows))
+	for i := range rows {
+		if records[i], err = rows[i].record(); err != nil {
+			return nil, 0, err
+		}
+	}
+	return records, total, nil
+}
+
+// GetRecord implements policy.AuditStore
+func (store *AuditStore) GetRecord(id int64) (*policy.AuditRecord, error) {
+	var row PolicyAudit
+	has, err := store.x.ID(id).Get(&row)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, policy.ErrRecordNotFound
+	}
+	return row.record()
+}
+
+func (row *PolicyAudit) record() (*policy.AuditRecord, error) {
+	record := &policy.AuditRecord{
+		ID:     row.ID,
+		Actor:  row.Actor,
+		Action: row.Action,
+		Time:   row.CreatedAt,
+	}
+	if err := json.Unmarshal([]byte(row.Before), &record.Before); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(row.After), &record.After); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
@@ -0,0 +1,23 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/Myriad-Dreamin/gin-middleware/auth/policy"
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestLint(t *testing.T) {
+	m, err := model.NewModelFromFile("../rbac.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := policy.Lint(m, policy.Snapshot{"p": {AdminPolicy}}, nil)
+	if policy.HasErrors(issues) {
+		t.Fatal(issues)
+	}
+	// the admin policy matches everything on purpose
+	for _, issue := range issues {
+		t.Log(issue)
+	}
+}